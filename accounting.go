@@ -0,0 +1,116 @@
+package lpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// job results of the accounting records
+const (
+	ResultCompleted = "completed"
+	ResultFailed    = "failed"
+	ResultRemoved   = "removed"
+)
+
+// AccountingRecord is emitted for every job once the queue is done with it
+type AccountingRecord struct {
+	User  string `json:"user"`
+	Host  string `json:"host"`
+	Class string `json:"class"`
+	Queue string `json:"queue"`
+	// Format is the output format of the first print line
+	Format string `json:"format"`
+	Bytes  int64  `json:"bytes"`
+	// Pages is the page count of the queue's page counter, zero if it is unknown
+	Pages int `json:"pages"`
+	// PagesExact is set if the page count is no estimate
+	PagesExact bool      `json:"pagesExact"`
+	Received   time.Time `json:"received"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func newAccountingRecord(job *Job, started time.Time, result error) AccountingRecord {
+	record := AccountingRecord{
+		User:     job.ControlFile[UserID],
+		Host:     job.ControlFile[Hostname],
+		Class:    job.ControlFile[BannerClass],
+		Queue:    job.Queue,
+		Bytes:    job.Size(),
+		Received: job.Received,
+		Started:  started,
+		Finished: time.Now(),
+		Result:   ResultCompleted,
+	}
+
+	if lines := job.PrintLines(); len(lines) > 0 {
+		record.Format = string(lines[0].Format)
+	}
+
+	switch result {
+	case nil:
+	case ErrJobRemoved:
+		record.Result = ResultRemoved
+	default:
+		record.Result = ResultFailed
+		record.Error = result.Error()
+	}
+
+	return record
+}
+
+// Accounter receives the accounting records of a queue, errors are logged by the queue
+type Accounter interface {
+	Account(record AccountingRecord) error
+}
+
+type AccounterFunc func(record AccountingRecord) error
+
+func (f AccounterFunc) Account(record AccountingRecord) error {
+	return f(record)
+}
+
+// BSDAccounting writes records in the format of the bsd lpd accounting file, the page count followed by the
+// host and user: "   3.00\thost:user". Only completed jobs are written.
+type BSDAccounting struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+func (b *BSDAccounting) Account(record AccountingRecord) error {
+	if record.Result != ResultCompleted {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := fmt.Fprintf(b.Writer, "%7.2f\t%s:%s\n", float64(record.Pages), record.Host, record.User)
+	return err
+}
+
+// JSONAccounting writes every record as a json object on a separate line
+type JSONAccounting struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+func (j *JSONAccounting) Account(record AccountingRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err = j.Writer.Write(append(data, '\n'))
+	return err
+}
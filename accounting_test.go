@@ -0,0 +1,133 @@
+package lpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountingWriters(t *testing.T) {
+	job := newTestJob(t, "hello world")
+	job.ControlFile[BannerClass] = "accounting"
+
+	record := newAccountingRecord(job, time.Now(), nil)
+	record.Pages = 3
+
+	bsd := new(bytes.Buffer)
+	if err := (&BSDAccounting{Writer: bsd}).Account(record); err != nil {
+		t.Fatalf("error while writing bsd record: %v", err)
+	}
+	if expected := "   3.00\thost:alice\n"; bsd.String() != expected {
+		t.Errorf("bsd record is not correct, expected %q, got %q", expected, bsd.String())
+	}
+
+	jsonLines := new(bytes.Buffer)
+	accounting := &JSONAccounting{Writer: jsonLines}
+	if err := accounting.Account(record); err != nil {
+		t.Fatalf("error while writing json record: %v", err)
+	}
+	if err := accounting.Account(newAccountingRecord(job, time.Now(), errors.New("printer on fire"))); err != nil {
+		t.Fatalf("error while writing json record: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(jsonLines.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two json lines, got %q", jsonLines.String())
+	}
+
+	var decoded AccountingRecord
+	if err := json.Unmarshal([]byte(lines[0]), &decoded); err != nil {
+		t.Fatalf("could not decode json record: %v", err)
+	}
+	if decoded.User != "alice" || decoded.Class != "accounting" || decoded.Queue != "lp" || decoded.Format != "f" ||
+		decoded.Bytes != 11 || decoded.Pages != 3 || decoded.Result != ResultCompleted {
+		t.Errorf("json record is not correct, got %+v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &decoded); err != nil {
+		t.Fatalf("could not decode json record: %v", err)
+	}
+	if decoded.Result != ResultFailed || decoded.Error != "printer on fire" {
+		t.Errorf("result of failed job is not correct, got %+v", decoded)
+	}
+}
+
+func TestQueueAccounting(t *testing.T) {
+	records := make(chan AccountingRecord, 1)
+	accounting := AccounterFunc(func(record AccountingRecord) error {
+		records <- record
+		return nil
+	})
+
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend(), Accounting: accounting})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", ControlFile{UserID: "alice", Hostname: "workstation"}, PostscriptFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	select {
+	case record := <-records:
+		if record.User != "alice" || record.Host != "workstation" || record.Format != "o" || record.Bytes != 4 || record.Result != ResultCompleted {
+			t.Errorf("accounting record is not correct, got %+v", record)
+		}
+		if record.Started.Before(record.Received) || record.Finished.Before(record.Started) {
+			t.Errorf("timestamps are not in order, got %+v", record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no accounting record received")
+	}
+}
+
+func TestQueueAccountingRemoved(t *testing.T) {
+	records := make(chan AccountingRecord, 1)
+	accounting := AccounterFunc(func(record AccountingRecord) error {
+		records <- record
+		return errors.New("disk full")
+	})
+
+	logs := make(logWriter, 1)
+	queue := &Queue{Name: "lp", Backend: newRecordingBackend(), Accounting: accounting, ErrorLog: log.New(logs, "", 0)}
+	queue.Stop()
+	_, client := startTestServer(t, queue)
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", ControlFile{UserID: "alice"}, PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	// the waiting job is removed before it was started
+	if err := client.RemoveJobs("lp", "alice", nil, []string{"alice"}); err != nil {
+		t.Fatalf("error while removing the job: %v", err)
+	}
+
+	select {
+	case record := <-records:
+		if record.User != "alice" || record.Result != ResultRemoved || record.Bytes != 4 {
+			t.Errorf("accounting record is not correct, got %+v", record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no accounting record received")
+	}
+
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "disk full") {
+			t.Errorf("accounting error is not logged, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("accounting error was not logged")
+	}
+}
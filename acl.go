@@ -0,0 +1,59 @@
+package lpd
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+var ErrAccessDenied = errors.New("access denied")
+
+// ACL restricts the clients of a queue. Empty lists allow everyone.
+type ACL struct {
+	// Hosts are ip addresses or networks in CIDR notation
+	Hosts []string
+	// Users are the user names which may print and remove jobs
+	Users []string
+}
+
+// allowAddr checks the remote address of a connection in host:port format
+func (a *ACL) allowAddr(addr string) bool {
+	if a == nil || len(a.Hosts) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowed := range a.Hosts {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *ACL) allowUser(user string) bool {
+	if a == nil || len(a.Users) == 0 {
+		return true
+	}
+
+	for _, allowed := range a.Users {
+		if allowed == user {
+			return true
+		}
+	}
+
+	return false
+}
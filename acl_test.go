@@ -0,0 +1,57 @@
+package lpd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	acl := &ACL{Hosts: []string{"10.0.0.0/8", "192.168.1.5", "::1"}, Users: []string{"alice"}}
+
+	for addr, allowed := range map[string]bool{
+		"10.1.2.3:721":     true,
+		"192.168.1.5:721":  true,
+		"192.168.1.6:721":  false,
+		"[::1]:721":        true,
+		"printserver:721":  false,
+		"172.16.0.1:12345": false,
+	} {
+		if acl.allowAddr(addr) != allowed {
+			t.Errorf("address %s: expected allowed to be %v", addr, allowed)
+		}
+	}
+
+	if !acl.allowUser("alice") || acl.allowUser("bob") {
+		t.Error("users are not checked correctly")
+	}
+
+	var empty *ACL
+	if !empty.allowAddr("10.1.2.3:721") || !empty.allowUser("bob") {
+		t.Error("a queue without acl has to allow everyone")
+	}
+}
+
+func TestServerACL(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		ACL     *ACL
+		Allowed bool
+	}{
+		{Name: "allowed", ACL: &ACL{Hosts: []string{"127.0.0.0/8"}, Users: []string{"alice"}}, Allowed: true},
+		{Name: "host", ACL: &ACL{Hosts: []string{"10.0.0.0/8"}}},
+		{Name: "user", ACL: &ACL{Users: []string{"bob"}}},
+	}
+
+	for _, c := range testCases {
+		_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend(), ACL: c.ACL})
+
+		err := client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, "lp", ControlFile{UserID: "alice"}, PlainTextFile)
+		if (err == nil) != c.Allowed {
+			t.Errorf("%s: expected allowed to be %v, got error %v", c.Name, c.Allowed, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package lpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// The admin protocol is line based, rfc 1179 has no administration commands. A client sends a command like
+// "hold lp 7 alice" per line. The server answers with the output of the command, followed by a line with "ok"
+// or "error: " and the error message.
+//
+//	status [queue ...]        show the state of the queues, all queues without a name
+//	enable queue|all          accept new jobs
+//	disable queue|all         reject new jobs
+//	start queue|all           deliver the jobs
+//	stop queue|all            stop the delivery after the active job
+//	restart queue|all         start the delivery and retry the active job right away
+//	hold queue job|user ...   keep the jobs in the queue until they are released
+//	release queue job|user ...
+//	topq queue job|user ...   move the jobs to the front of the queue
+const (
+	adminOK    = "ok"
+	adminError = "error: "
+)
+
+// ServeAdmin accepts admin connections on the listener, usually a unix socket which is only accessible by the
+// operators. It returns ErrServerClosed after Shutdown or Close.
+func (s *Server) ServeAdmin(l net.Listener) error {
+	if !s.addListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.removeListener(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		go s.serveAdmin(conn)
+	}
+}
+
+func (s *Server) serveAdmin(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		output, err := s.admin(fields[0], fields[1:])
+		w.WriteString(output)
+		if err != nil {
+			w.WriteString(adminError + err.Error() + "\n")
+		} else {
+			w.WriteString(adminOK + "\n")
+		}
+
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// admin runs an admin command and returns its output
+func (s *Server) admin(cmd string, args []string) (string, error) {
+	switch cmd {
+	case "status":
+		if len(args) == 0 {
+			args = []string{"all"}
+		}
+
+		var output strings.Builder
+		for _, name := range args {
+			queues, err := s.adminQueues(name)
+			if err != nil {
+				return output.String(), err
+			}
+			for _, q := range queues {
+				writeAdminStatus(&output, q.Status())
+			}
+		}
+		return output.String(), nil
+	case "enable", "disable", "start", "stop", "restart":
+		if len(args) != 1 {
+			return "", fmt.Errorf("usage: %s queue|all", cmd)
+		}
+		queues, err := s.adminQueues(args[0])
+		if err != nil {
+			return "", err
+		}
+
+		for _, q := range queues {
+			switch cmd {
+			case "enable":
+				q.Enable()
+			case "disable":
+				q.Disable()
+			case "start":
+				q.Start()
+			case "stop":
+				q.Stop()
+			case "restart":
+				q.Restart()
+			}
+		}
+		return "", nil
+	case "hold", "release", "topq":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: %s queue job|user ...", cmd)
+		}
+		q := s.Queue(args[0])
+		if q == nil {
+			return "", fmt.Errorf("unknown queue %s", args[0])
+		}
+
+		switch cmd {
+		case "hold":
+			return "", q.Hold(args[1:]...)
+		case "release":
+			return "", q.Release(args[1:]...)
+		default:
+			return "", q.Topq(args[1:]...)
+		}
+	}
+
+	return "", fmt.Errorf("unknown command %s", cmd)
+}
+
+// adminQueues returns the queue with the name or all queues sorted by name
+func (s *Server) adminQueues(name string) ([]*Queue, error) {
+	if name != "all" {
+		q := s.Queue(name)
+		if q == nil {
+			return nil, fmt.Errorf("unknown queue %s", name)
+		}
+		return []*Queue{q}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queues := make([]*Queue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q)
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Name < queues[j].Name })
+
+	return queues, nil
+}
+
+// writeAdminStatus writes the state of a queue like the bsd lpc
+func writeAdminStatus(w *strings.Builder, status QueueStatus) {
+	enabled := map[bool]string{true: "enabled", false: "disabled"}
+
+	fmt.Fprintf(w, "%s:\n", status.Name)
+	fmt.Fprintf(w, "\tqueuing is %s\n", enabled[status.Queuing])
+	fmt.Fprintf(w, "\tprinting is %s\n", enabled[status.Printing])
+	fmt.Fprintf(w, "\t%d entries in spool area, %d held\n", status.Jobs, status.Held)
+}
+
+// AdminClient sends commands to the admin listener of a server
+type AdminClient struct {
+	// Network and Addr are passed to net.Dial
+	Network string
+	Addr    string
+}
+
+// NewAdminClient returns a client for the admin unix socket at the path
+func NewAdminClient(path string) *AdminClient {
+	return &AdminClient{Network: "unix", Addr: path}
+}
+
+// Command sends an admin command and returns its output
+func (c *AdminClient) Command(cmd string, args ...string) (string, error) {
+	conn, err := net.Dial(c.Network, c.Addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	line := strings.Join(append([]string{cmd}, args...), " ")
+	if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == adminOK:
+			return output.String(), nil
+		case strings.HasPrefix(line, adminError):
+			return output.String(), errors.New(strings.TrimPrefix(line, adminError))
+		}
+		output.WriteString(line + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return output.String(), err
+	}
+
+	return output.String(), errors.New("admin connection closed without an answer")
+}
@@ -0,0 +1,122 @@
+package lpd
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func queueOwners(q *Queue) []string {
+	var owners []string
+	for _, job := range q.Jobs() {
+		owners = append(owners, job.ControlFile[UserID])
+	}
+
+	return owners
+}
+
+func TestQueueAdmin(t *testing.T) {
+	q := &Queue{Name: "lp"}
+	q.init()
+	for i, user := range []string{"alice", "bob", "carol", "dave"} {
+		q.jobs = append(q.jobs, &Job{Number: i + 1, ControlFile: ControlFile{UserID: user}})
+	}
+
+	if err := q.Hold("alice", "2"); err != nil {
+		t.Fatalf("error while holding jobs: %v", err)
+	}
+	if job := q.next(); job == nil || job.ControlFile[UserID] != "carol" {
+		t.Fatalf("held jobs were not skipped, got %v", job)
+	}
+	if got := strings.Join(queueOwners(q), ","); got != "carol,alice,bob,dave" {
+		t.Errorf("active job was not moved to the front, got %s", got)
+	}
+
+	if err := q.Topq("dave", "bob"); err != nil {
+		t.Fatalf("error while moving jobs: %v", err)
+	}
+	if got := strings.Join(queueOwners(q), ","); got != "carol,bob,dave,alice" {
+		t.Errorf("jobs were not moved behind the active job, got %s", got)
+	}
+	if status := q.Status(); status.Jobs != 4 || status.Held != 1 {
+		t.Errorf("status is not correct, got %+v", status)
+	}
+
+	if err := q.Hold("erin"); err == nil {
+		t.Error("holding an unknown job did not fail")
+	}
+
+	q.Stop()
+	q.active = nil
+	if job := q.next(); job != nil {
+		t.Errorf("stopped queue selected job %d", job.Number)
+	}
+	q.Start()
+	if job := q.next(); job == nil || job.ControlFile[UserID] != "carol" {
+		t.Errorf("started queue did not select the first job, got %v", job)
+	}
+}
+
+func TestServerAdmin(t *testing.T) {
+	backend := newRecordingBackend()
+	s, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go s.ServeAdmin(l)
+
+	admin := NewAdminClient(path)
+	printDocument := func() error {
+		return client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, "lp", ControlFile{UserID: "alice"}, PlainTextFile)
+	}
+
+	if _, err := admin.Command("stop", "lp"); err != nil {
+		t.Fatalf("error while stopping queue: %v", err)
+	}
+	if err := printDocument(); err != nil {
+		t.Fatalf("stopped queue rejected a job: %v", err)
+	}
+
+	if _, err := admin.Command("disable", "all"); err != nil {
+		t.Fatalf("error while disabling queue: %v", err)
+	}
+	if err := printDocument(); err == nil {
+		t.Error("disabled queue accepted a job")
+	}
+
+	status, err := admin.Command("status")
+	if err != nil {
+		t.Fatalf("error while getting status: %v", err)
+	}
+	for _, line := range []string{"lp:", "queuing is disabled", "printing is disabled", "1 entries"} {
+		if !strings.Contains(status, line) {
+			t.Errorf("status does not contain %q, got %q", line, status)
+		}
+	}
+
+	select {
+	case <-backend.jobs:
+		t.Fatal("stopped queue delivered a job")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := admin.Command("start", "lp"); err != nil {
+		t.Fatalf("error while starting queue: %v", err)
+	}
+	backend.next(t)
+
+	for _, cmd := range [][]string{{"hold", "lp"}, {"start", "unknown"}, {"shutdown"}} {
+		if _, err := admin.Command(cmd[0], cmd[1:]...); err == nil {
+			t.Errorf("invalid command %v did not fail", cmd)
+		}
+	}
+}
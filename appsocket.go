@@ -0,0 +1,119 @@
+package lpd
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAppSocketPort is the raw printing port used by AppSocket/JetDirect printers
+const DefaultAppSocketPort = 9100
+
+var DefaultDialTimeout = 30 * time.Second
+
+// printerLocks ensures only one job is sent to a printer address at a time, even if several queues share it
+var printerLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+func lockPrinter(addr string) func() {
+	printerLocks.Lock()
+	lock, ok := printerLocks.locks[addr]
+	if !ok {
+		lock = new(sync.Mutex)
+		printerLocks.locks[addr] = lock
+	}
+	printerLocks.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+func NewAppSocket(remote string, port int) *AppSocket {
+	return &AppSocket{
+		Addr: net.JoinHostPort(remote, strconv.Itoa(port)),
+	}
+}
+
+// AppSocket is a backend which streams the data files of a job to a raw tcp port like 9100.
+// Failed jobs are retried by the queue, a retry only sends the print lines which were not sent yet.
+type AppSocket struct {
+	// Addr format is host:port
+	Addr string
+	// CRLF converts the line endings of plain text files ('f') to CRLF, files printed with 'l' are always sent raw
+	CRLF bool
+	// DialTimeout defaults to DefaultDialTimeout
+	DialTimeout time.Duration
+}
+
+func (a *AppSocket) Deliver(job *Job) error {
+	unlock := lockPrinter(a.Addr)
+	defer unlock()
+
+	timeout := a.DialTimeout
+	if timeout == 0 {
+		timeout = DefaultDialTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", a.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for i, line := range job.PrintLines() {
+		df := job.DataFile(line.File)
+		if df == nil || job.isDelivered(i) {
+			continue
+		}
+
+		var w io.Writer = conn
+		if a.CRLF && line.Format == PlainTextFile {
+			w = &crlfWriter{w: conn}
+		}
+
+		if err := copyDataFile(w, df); err != nil {
+			return err
+		}
+		job.setDelivered(i)
+	}
+
+	return nil
+}
+
+func copyDataFile(w io.Writer, df *DataFile) error {
+	f, err := df.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// crlfWriter replaces LF line endings with CRLF, existing CRLF line endings are kept
+type crlfWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+len(p)/8)
+	for _, b := range p {
+		if b == '\n' && c.last != '\r' {
+			buf = append(buf, '\r')
+		}
+		buf = append(buf, b)
+		c.last = b
+	}
+
+	if _, err := c.w.Write(buf); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
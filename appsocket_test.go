@@ -0,0 +1,171 @@
+package lpd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppSocketDeliver(t *testing.T) {
+	testCases := []struct {
+		Format OutputFormat
+		CRLF   bool
+		Data   string
+		Sent   string
+	}{
+		{
+			Format: PrintWithLeavingControlCharacters,
+			CRLF:   true,
+			Data:   "line 1\nline 2\n",
+			Sent:   "line 1\nline 2\n",
+		},
+		{
+			Format: PlainTextFile,
+			CRLF:   false,
+			Data:   "line 1\nline 2\n",
+			Sent:   "line 1\nline 2\n",
+		},
+		{
+			Format: PlainTextFile,
+			CRLF:   true,
+			Data:   "line 1\nline 2\r\n",
+			Sent:   "line 1\r\nline 2\r\n",
+		},
+	}
+
+	for _, c := range testCases {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+
+		received := make(chan []byte, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			data, _ := ioutil.ReadAll(conn)
+			received <- data
+		}()
+
+		path := filepath.Join(t.TempDir(), "dfA001host")
+		if err := ioutil.WriteFile(path, []byte(c.Data), 0600); err != nil {
+			t.Fatalf("could not write data file: %v", err)
+		}
+
+		job := &Job{
+			RawControlFile: append([]byte{byte(c.Format)}, "dfA001host\n"...),
+			DataFiles:      []*DataFile{{Name: "dfA001host", Size: int64(len(c.Data)), Path: path}},
+		}
+
+		backend := &AppSocket{Addr: l.Addr().String(), CRLF: c.CRLF}
+		if err := backend.Deliver(job); err != nil {
+			t.Errorf("error while delivering job: %v", err)
+		}
+
+		if data := <-received; !bytes.Equal(data, []byte(c.Sent)) {
+			t.Errorf("sent data is not correct for format %c, expected %q, got %q", c.Format, c.Sent, data)
+		}
+
+		l.Close()
+	}
+}
+
+// acceptData accepts connections on l and sends the data received on every connection
+func acceptData(l net.Listener) <-chan []byte {
+	received := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			data, _ := ioutil.ReadAll(conn)
+			conn.Close()
+			received <- data
+		}
+	}()
+
+	return received
+}
+
+func TestAppSocketRetry(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	received := acceptData(l)
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "dfA001host"), filepath.Join(dir, "dfB001host")
+	if err := ioutil.WriteFile(first, []byte("first"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	// the second data file is missing, so the first attempt fails after the first print line
+	job := &Job{
+		RawControlFile: []byte("Halice\nldfA001host\nldfB001host\n"),
+		DataFiles:      []*DataFile{{Name: "dfA001host", Size: 5, Path: first}, {Name: "dfB001host", Size: 6, Path: second}},
+	}
+
+	backend := &AppSocket{Addr: l.Addr().String()}
+	if err := backend.Deliver(job); err == nil {
+		t.Fatal("expected an error for the missing data file")
+	}
+	if data := <-received; string(data) != "first" {
+		t.Errorf("sent data is not correct, expected %q, got %q", "first", data)
+	}
+
+	if err := ioutil.WriteFile(second, []byte("second"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while retrying job: %v", err)
+	}
+
+	// the retry sends only the print line which failed
+	if data := <-received; string(data) != "second" {
+		t.Errorf("retried data is not correct, expected %q, got %q", "second", data)
+	}
+}
+
+func TestAppSocketPrinterLock(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	received := acceptData(l)
+
+	// another queue is sending a job to the same printer
+	unlock := lockPrinter(l.Addr().String())
+
+	errc := make(chan error, 1)
+	go func() {
+		backend := &AppSocket{Addr: l.Addr().String()}
+		errc <- backend.Deliver(newTestJob(t, "data"))
+	}()
+
+	select {
+	case data := <-received:
+		t.Fatalf("job was sent while the printer was busy, got %q", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+
+	if err := <-errc; err != nil {
+		t.Fatalf("error while delivering job: %v", err)
+	}
+	if data := <-received; string(data) != "data" {
+		t.Errorf("sent data is not correct, expected %q, got %q", "data", data)
+	}
+}
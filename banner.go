@@ -0,0 +1,138 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const bannerDateFormat = "Mon Jan 2 15:04:05 2006"
+
+// Banner renders the banner page of a job. The queue prints it in front of the data files of every job whose
+// control file contains the print banner command ('L'), like the bsd lpd does.
+type Banner struct {
+	// PostScript renders the banner as a postscript page printed with 'o', instead of plain text printed with 'l'
+	PostScript bool
+	// Date is printed on the banner, defaults to the current time
+	Date time.Time
+}
+
+// bannerLines returns the labels and values printed on the banner page
+func bannerLines(job *Job) [][2]string {
+	user := job.ControlFile[PrintBanner]
+	if user == "" {
+		user = job.ControlFile[UserID]
+	}
+
+	return [][2]string{
+		{"User", user},
+		{"Host", job.ControlFile[Hostname]},
+		{"Job", job.ControlFile[JobName]},
+		{"Class", job.ControlFile[BannerClass]},
+		{"Queue", job.Queue},
+	}
+}
+
+func (b *Banner) date() time.Time {
+	if b.Date.IsZero() {
+		return time.Now()
+	}
+
+	return b.Date
+}
+
+// Render writes the banner page of the job
+func (b *Banner) Render(w io.Writer, job *Job) error {
+	if b.PostScript {
+		return b.renderPostScript(w, job)
+	}
+
+	return b.renderText(w, job)
+}
+
+func (b *Banner) renderText(w io.Writer, job *Job) error {
+	bw := bufio.NewWriter(w)
+	rule := strings.Repeat("*", 60)
+
+	fmt.Fprintf(bw, "\n\n%s\n\n", rule)
+	for _, line := range bannerLines(job) {
+		fmt.Fprintf(bw, "    %-8s %s\n", line[0]+":", line[1])
+	}
+	fmt.Fprintf(bw, "    %-8s %s\n", "Date:", b.date().Format(bannerDateFormat))
+	fmt.Fprintf(bw, "\n%s\n\f", rule)
+
+	return bw.Flush()
+}
+
+func (b *Banner) renderPostScript(w io.Writer, job *Job) error {
+	bw := bufio.NewWriter(w)
+	lines := bannerLines(job)
+
+	bw.WriteString("%!PS-Adobe-3.0\n%%Pages: 1\n%%EndComments\n%%Page: 1 1\n")
+	fmt.Fprintf(bw, "/Helvetica-Bold findfont 36 scalefont setfont\n72 680 moveto (%s) show\n", postScriptString(lines[0][1]))
+	bw.WriteString("/Helvetica findfont 14 scalefont setfont\n")
+
+	y := 630
+	for _, line := range lines[1:] {
+		fmt.Fprintf(bw, "72 %d moveto (%s: %s) show\n", y, line[0], postScriptString(line[1]))
+		y -= 22
+	}
+	fmt.Fprintf(bw, "72 %d moveto (Date: %s) show\n", y, postScriptString(b.date().Format(bannerDateFormat)))
+	bw.WriteString("showpage\n%%EOF\n")
+
+	return bw.Flush()
+}
+
+// postScriptString escapes the characters with a special meaning in postscript strings
+func postScriptString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+// addTo returns a copy of the job with the banner page printed before its data files
+func (b *Banner) addTo(job *Job) (*Job, *DataFile, error) {
+	if len(job.DataFiles) == 0 {
+		return job, nil, nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(job.DataFiles[0].Path), "lpd-banner")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	df := &DataFile{Name: "banner" + job.ControlFileName, Path: f.Name()}
+	if err := b.Render(f, job); err != nil {
+		removeDataFiles([]*DataFile{df})
+		return nil, nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		removeDataFiles([]*DataFile{df})
+		return nil, nil, err
+	}
+	df.Size = stat.Size()
+
+	format := PrintWithLeavingControlCharacters
+	if b.PostScript {
+		format = PostscriptFile
+	}
+
+	bannered := *job
+	bannered.DataFiles = append([]*DataFile{df}, job.DataFiles...)
+	bannered.RawControlFile = append([]byte(fmt.Sprintf("%c%s%s", format, df.Name, LineEnding)), job.RawControlFile...)
+
+	cf, err := NewControlFileDecoder(bytes.NewReader(bannered.RawControlFile)).Decode(len(bannered.RawControlFile))
+	if err != nil {
+		removeDataFiles([]*DataFile{df})
+		return nil, nil, err
+	}
+	bannered.ControlFile = cf
+
+	return &bannered, df, nil
+}
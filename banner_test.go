@@ -0,0 +1,64 @@
+package lpd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBannerRender(t *testing.T) {
+	job := newTestJob(t, "data")
+	job.ControlFile[PrintBanner] = "alice"
+	job.ControlFile[BannerClass] = "accounting"
+	job.ControlFile[JobName] = "report (final)"
+
+	date := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	out := new(bytes.Buffer)
+	if err := (&Banner{Date: date}).Render(out, job); err != nil {
+		t.Fatalf("error while rendering banner: %v", err)
+	}
+
+	for _, expected := range []string{"User:    alice", "Host:    host", "Job:     report (final)", "Class:   accounting", "Date:    Mon Mar 4 05:06:07 2019"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("text banner does not contain %q, got %q", expected, out.String())
+		}
+	}
+	if !strings.HasSuffix(out.String(), "\f") {
+		t.Errorf("text banner does not end with a form feed")
+	}
+
+	out.Reset()
+	if err := (&Banner{PostScript: true, Date: date}).Render(out, job); err != nil {
+		t.Fatalf("error while rendering banner: %v", err)
+	}
+
+	if !strings.HasPrefix(out.String(), "%!PS") || !strings.Contains(out.String(), `(Job: report \(final\)) show`) {
+		t.Errorf("postscript banner is not correct, got %q", out.String())
+	}
+}
+
+func TestQueueBanner(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend, Banner: &Banner{}})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", ControlFile{PrintBanner: "alice"}, PostscriptFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	received := backend.next(t)
+
+	lines := received.Job.PrintLines()
+	if len(lines) != 2 || lines[0].Format != PrintWithLeavingControlCharacters || lines[1].Format != PostscriptFile {
+		t.Fatalf("print lines are not correct, got %v", lines)
+	}
+	if !strings.Contains(string(received.Data), "User:    alice") || !strings.HasSuffix(string(received.Data), "\fdata") {
+		t.Errorf("banner is not printed before the data file, got %q", received.Data)
+	}
+}
@@ -1,14 +1,16 @@
 package lpd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"os"
 	"os/user"
 	"path"
 	"strconv"
+	"time"
 )
 
 type Document struct {
@@ -19,13 +21,15 @@ type Document struct {
 
 func NewClient(remote string, port int) *Client {
 	return &Client{
-		dest: fmt.Sprintf("%s:%d", remote, port),
+		dest: net.JoinHostPort(remote, strconv.Itoa(port)),
 	}
 }
 
 type Client struct {
 	// dest format is host:port
 	dest string
+	// Timeout limits the dial and every read and write of a connection, zero means no timeout
+	Timeout time.Duration
 }
 
 func (c *Client) PrintFile(filePath, queue string, cf ControlFile) error {
@@ -49,7 +53,35 @@ func (c *Client) PrintFile(filePath, queue string, cf ControlFile) error {
 	}, queue, cf, PlainTextFile)
 }
 
-func (c *Client) PrintDocument(doc Document, queue string, cf ControlFile, of OutputFormat) (err error) {
+func (c *Client) PrintDocument(doc Document, queue string, cf ControlFile, of OutputFormat) error {
+	return c.PrintDocumentWithOptions(doc, queue, cf, of, PrintOptions{})
+}
+
+// PrintOptions are job options which can not be expressed by the control file map
+type PrintOptions struct {
+	// Copies is the number of copies printed, the print line is repeated in the control file
+	Copies int
+	// NoBanner suppresses the banner page, the L line is not sent
+	NoBanner bool
+}
+
+func (c *Client) PrintDocumentWithOptions(doc Document, queue string, cf ControlFile, of OutputFormat, opts PrintOptions) error {
+	return c.PrintDocumentsWithOptions([]Document{doc}, queue, cf, of, opts)
+}
+
+// maxDocuments is the number of data file names of a job, the names are numbered with A-Z and a-z like bsd lpr does
+const maxDocuments = 52
+
+// PrintDocumentsWithOptions sends the documents as one job, the control file prints the data files in order.
+// The job name defaults to the name of the first document.
+func (c *Client) PrintDocumentsWithOptions(docs []Document, queue string, cf ControlFile, of OutputFormat, opts PrintOptions) (err error) {
+	if len(docs) == 0 {
+		return errors.New("no document to print")
+	}
+	if len(docs) > maxDocuments {
+		return fmt.Errorf("a job can hold at most %d documents", maxDocuments)
+	}
+
 	// get hostname
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -63,19 +95,22 @@ func (c *Client) PrintDocument(doc Document, queue string, cf ControlFile, of Ou
 	}
 
 	controlFileName := "cfA000" + hostname
-	dataFileName := "dfA000" + hostname
+	dataFileNames := make([]string, len(docs))
+	for i := range docs {
+		dataFileNames[i] = "df" + string(dataFileLetter(i)) + "000" + hostname
+	}
 
-	// build control file
+	// build control file, the lines of the first document are part of the map
 	controlFile := make(ControlFile)
 	controlFile[Hostname] = hostname
 	controlFile[UserID] = currentUser.Username
-	controlFile[JobName] = doc.Name
+	controlFile[JobName] = docs[0].Name
 	controlFile[BannerClass] = hostname
 	controlFile[PrintBanner] = currentUser.Username
-	controlFile[UnlinkDataFile] = dataFileName
-	controlFile[SourceFileName] = doc.Name
+	controlFile[UnlinkDataFile] = dataFileNames[0]
+	controlFile[SourceFileName] = docs[0].Name
 
-	controlFile[ControlFileCommand(of)] = dataFileName
+	controlFile[ControlFileCommand(of)] = dataFileNames[0]
 
 	// append custom cf params
 	if cf != nil {
@@ -84,24 +119,28 @@ func (c *Client) PrintDocument(doc Document, queue string, cf ControlFile, of Ou
 		}
 	}
 
+	if opts.NoBanner {
+		delete(controlFile, PrintBanner)
+	}
+
 	// open connection
-	conn, err := net.Dial("tcp", c.dest)
+	session, err := c.Dial()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer session.Close()
 
 	// send receive job command
-	err = SendCommandLine(conn, byte(ReceiveJob), []string{queue})
-	if err != nil {
-		return
-	}
-	if err = CheckAcknowledge(conn); err != nil {
+	if err = session.ReceiveJob(queue); err != nil {
 		return
 	}
 
 	// ensure the we send abort if we return with error
-	defer SendAbortOnError(conn, err)
+	defer func() {
+		if err != nil {
+			session.Abort()
+		}
+	}()
 
 	// write controlfile to buffer, so we can capture the size
 	encodedControlFile, err := controlFile.Encode()
@@ -109,117 +148,126 @@ func (c *Client) PrintDocument(doc Document, queue string, cf ControlFile, of Ou
 		return
 	}
 
-	// send controlfile sub command
-	err = SendCommandLine(conn, byte(SendControlFile), []string{strconv.Itoa(len(encodedControlFile)), controlFileName})
-	if err != nil {
-		return
-	}
-	if err = CheckAcknowledge(conn); err != nil {
-		return
+	// every further copy repeats the print line
+	for i := 1; i < opts.Copies; i++ {
+		encodedControlFile = append(encodedControlFile, byte(of))
+		encodedControlFile = append(encodedControlFile, dataFileNames[0]+LineEnding...)
 	}
 
-	// send controlfile
-	_, err = conn.Write(encodedControlFile)
-	if err != nil {
-		return
-	}
-	_, err = conn.Write([]byte{0})
-	if err != nil {
-		return
+	// the further documents follow with their own print, source file name and unlink lines
+	buf := bytes.NewBuffer(encodedControlFile)
+	enc := NewControlFileCommandEncoder(buf)
+	copies := opts.Copies
+	if copies < 1 {
+		copies = 1
 	}
-	if err = CheckAcknowledge(conn); err != nil {
-		return
+	for i, doc := range docs[1:] {
+		name := dataFileNames[i+1]
+		for n := 0; n < copies; n++ {
+			enc.Encode(ControlFileCommand(of), name)
+		}
+		enc.Encode(SourceFileName, doc.Name)
+		enc.Encode(UnlinkDataFile, name)
 	}
+	encodedControlFile = buf.Bytes()
 
-	// send datafile sub command
-	err = SendCommandLine(conn, byte(SendDataFile), []string{strconv.Itoa(doc.Size), dataFileName})
-	if err != nil {
-		return
-	}
-	if err = CheckAcknowledge(conn); err != nil {
+	// send controlfile
+	if err = session.SendControlFile(controlFileName, encodedControlFile); err != nil {
 		return
 	}
 
-	// send spool file
-	if _, err = io.Copy(conn, doc.Document); err != nil {
-		return
-	}
-	_, err = conn.Write([]byte{0})
-	if err != nil {
-		return
-	}
-	if err = CheckAcknowledge(conn); err != nil {
-		return
+	// send spool files
+	for i, doc := range docs {
+		if err = session.SendDataFile(dataFileNames[i], int64(doc.Size), doc.Document); err != nil {
+			return
+		}
 	}
 
 	return nil
 }
 
-func (c *Client) PrintWaitingJobs(queue string) (err error) {
-	// open connection
-	conn, err := net.Dial("tcp", c.dest)
-	if err != nil {
-		return err
+// dataFileLetter returns the letter which numbers the i-th data file of a job
+func dataFileLetter(i int) byte {
+	if i < 26 {
+		return byte('A' + i)
 	}
-	defer conn.Close()
 
-	err = SendCommandLine(conn, byte(PrintJobs), []string{queue})
-	if err != nil {
-		return
-	}
-	err = CheckAcknowledge(conn)
+	return byte('a' + i - 26)
+}
 
-	return
+// Preprocessor renders a document on the client, e.g. PRFormatter or FortranFormatter
+type Preprocessor interface {
+	Document(doc Document, cf ControlFile) (Document, error)
 }
 
-func (c *Client) GetQueueStateShort(queue string, jobNumbers, usernames []string) (state string, err error) {
-	conn, err := net.Dial("tcp", c.dest)
+// PrintPreprocessed renders the document with the preprocessor and prints the result with the 'l' command,
+// for servers which do not implement the output format themselves
+func (c *Client) PrintPreprocessed(doc Document, queue string, cf ControlFile, p Preprocessor) error {
+	rendered, err := p.Document(doc, cf)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer conn.Close()
 
-	// TODO: send username and job number if given
-	err = SendCommandLine(conn, byte(QueueStatsShort), []string{queue})
+	return c.PrintDocument(rendered, queue, cf, PrintWithLeavingControlCharacters)
+}
+
+func (c *Client) PrintWaitingJobs(queue string) error {
+	session, err := c.Dial()
 	if err != nil {
-		return
+		return err
 	}
+	defer session.Close()
+
+	return session.PrintJobs(queue)
+}
+
+func (c *Client) GetQueueStateShort(queue string, jobNumbers, usernames []string) (string, error) {
+	return c.getQueueState(queue, false, jobNumbers, usernames)
+}
 
-	data, err := ioutil.ReadAll(conn)
-	return string(data), err
+func (c *Client) GetQueueStateLong(queue string, jobNumbers, usernames []string) (string, error) {
+	return c.getQueueState(queue, true, jobNumbers, usernames)
 }
 
-func (c *Client) GetQueueStateLong(queue string, jobNumbers, usernames []string) (state string, err error) {
-	conn, err := net.Dial("tcp", c.dest)
+func (c *Client) getQueueState(queue string, long bool, jobNumbers, usernames []string) (string, error) {
+	session, err := c.Dial()
 	if err != nil {
 		return "", err
 	}
-	defer conn.Close()
+	defer session.Close()
+
+	return session.QueueState(queue, long, commandList(jobNumbers, usernames))
+}
+
+// GetQueueState requests the short or long queue state and parses the answer
+func (c *Client) GetQueueState(queue string, long bool, jobNumbers, usernames []string) (*QueueState, error) {
+	getState := c.GetQueueStateShort
+	if long {
+		getState = c.GetQueueStateLong
+	}
 
-	// TODO: send username and job number if given
-	err = SendCommandLine(conn, byte(QueueStatsLong), []string{queue})
+	state, err := getState(queue, jobNumbers, usernames)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(conn)
-	return string(data), err
+	return ParseQueueState(state, long)
 }
 
 // agent is the username making the request
-func (c *Client) RemoveJobs(queue, agent string, jobNumbers, usernames []string) (err error) {
-	conn, err := net.Dial("tcp", c.dest)
+func (c *Client) RemoveJobs(queue, agent string, jobNumbers, usernames []string) error {
+	session, err := c.Dial()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer session.Close()
 
-	// TODO: send username and job number if given
-	err = SendCommandLine(conn, byte(RemoveJobs), []string{queue, agent})
-	if err != nil {
-		return
-	}
-	err = CheckAcknowledge(conn)
+	return session.RemoveJobs(queue, agent, commandList(jobNumbers, usernames))
+}
 
-	return
+// commandList joins user names and job numbers to the operand list of the queue state and remove commands
+func commandList(jobNumbers, usernames []string) []string {
+	list := make([]string, 0, len(usernames)+len(jobNumbers))
+	list = append(list, usernames...)
+	return append(list, jobNumbers...)
 }
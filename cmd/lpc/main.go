@@ -0,0 +1,75 @@
+// Command lpc controls the queues of an lpd server over its admin socket. Without a command it reads one
+// command per line from the standard input.
+//
+//	lpc [-s socket] [command [argument ...]]
+//
+// The commands are status, enable, disable, start, stop, restart, hold, release and topq, see lpd.ServeAdmin.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/phin1x/go-lpd"
+)
+
+const defaultSocket = "/run/lpd/admin.sock"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "lpc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("lpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	socket := fs.String("s", defaultSocket, "admin `socket` of the server")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client := lpd.NewAdminClient(*socket)
+
+	if fs.NArg() > 0 {
+		return command(client, stdout, fs.Args())
+	}
+
+	// every command of the standard input is run, a failed command does not stop the following ones
+	var failed error
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			break
+		}
+
+		if err := command(client, stdout, fields); err != nil {
+			fmt.Fprintf(stderr, "lpc: %s: %v\n", fields[0], err)
+			failed = err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return failed
+}
+
+func command(client *lpd.AdminClient, w io.Writer, args []string) error {
+	output, err := client.Command(args[0], args[1:]...)
+	if _, writeErr := io.WriteString(w, output); writeErr != nil {
+		return writeErr
+	}
+
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-lpd"
+)
+
+type discardBackend struct{}
+
+func (discardBackend) Deliver(job *lpd.Job) error {
+	return nil
+}
+
+func startTestServer(t *testing.T) (*lpd.Server, string) {
+	t.Helper()
+
+	s := lpd.NewServer("127.0.0.1:0")
+	s.SpoolDir = t.TempDir()
+	s.AddQueue(&lpd.Queue{Name: "lp", Backend: discardBackend{}})
+	s.AddQueue(&lpd.Queue{Name: "laser", Backend: discardBackend{}})
+
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	go s.ServeAdmin(l)
+	t.Cleanup(func() { s.Close() })
+
+	return s, path
+}
+
+func TestLpc(t *testing.T) {
+	s, path := startTestServer(t)
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-s", path, "disable", "lp"}, nil, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while running command: %v", err)
+	}
+	if s.Queue("lp").Status().Queuing {
+		t.Error("queue was not disabled")
+	}
+
+	if err := run([]string{"-s", path, "topq", "lp", "7"}, nil, out, ioutil.Discard); err == nil {
+		t.Error("moving an unknown job did not fail")
+	}
+}
+
+func TestLpcStdin(t *testing.T) {
+	s, path := startTestServer(t)
+
+	stdin := strings.NewReader("stop all\n\nstatus laser\nunknown\nquit\nstart all\n")
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	if err := run([]string{"-s", path}, stdin, out, errOut); err == nil {
+		t.Error("failed command was not reported")
+	}
+
+	if !strings.Contains(out.String(), "laser:\n\tqueuing is enabled\n\tprinting is disabled") {
+		t.Errorf("status is not correct, got %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "unknown command") {
+		t.Errorf("error was not printed, got %q", errOut.String())
+	}
+	if s.Queue("lp").Status().Printing {
+		t.Error("commands after quit were run")
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/phin1x/go-lpd"
+	"github.com/phin1x/go-lpd/printcap"
+)
+
+// Config is the json config file of the daemon. A printcap file can be used as config file too, its entries are
+// served as queues with the default settings of the server.
+type Config struct {
+	// Listen defaults to :515
+	Listen string `json:"listen"`
+	// AdminSocket is the path of the unix socket used by lpc, the admin socket is disabled if it is empty
+	AdminSocket string        `json:"admin_socket"`
+	SpoolDir    string        `json:"spool_dir"`
+	Limits      LimitsConfig  `json:"limits"`
+	Timeouts    TimeoutConfig `json:"timeouts"`
+	Queues      []QueueConfig `json:"queues"`
+	// Printcap is the path of a printcap file, its entries are served as further queues. The largest size limit
+	// (mx) of the entries is the data file limit of the server, unless max_data_file_size is set.
+	Printcap string `json:"printcap"`
+
+	printcap *printcap.File
+}
+
+type LimitsConfig struct {
+	MaxControlFileSize int64 `json:"max_control_file_size"`
+	MaxDataFileSize    int64 `json:"max_data_file_size"`
+	MaxJobSize         int64 `json:"max_job_size"`
+	MaxDataFiles       int   `json:"max_data_files"`
+	MaxSpoolSize       int64 `json:"max_spool_size"`
+	MaxConns           int   `json:"max_conns"`
+	MaxConnsPerIP      int   `json:"max_conns_per_ip"`
+}
+
+type TimeoutConfig struct {
+	Idle            Duration `json:"idle"`
+	Header          Duration `json:"header"`
+	Transfer        Duration `json:"transfer"`
+	MinTransferRate int64    `json:"min_transfer_rate"`
+	Write           Duration `json:"write"`
+}
+
+type QueueConfig struct {
+	Name          string                  `json:"name"`
+	Backend       BackendConfig           `json:"backend"`
+	RetryInterval Duration                `json:"retry_interval"`
+	MaxAttempts   int                     `json:"max_attempts"`
+	Filters       map[string]FilterConfig `json:"filters"`
+	// Banner is "text" or "postscript", banner pages are not printed if it is empty
+	Banner     string            `json:"banner"`
+	Accounting *AccountingConfig `json:"accounting"`
+	Mail       *MailConfig       `json:"mail"`
+	ACL        *ACLConfig        `json:"acl"`
+}
+
+// BackendConfig selects the backend by its type: relay, appsocket, ipp, directory or command
+type BackendConfig struct {
+	Type string `json:"type"`
+	// Host and Port of the relay and appsocket backends, the port defaults to the standard port of the protocol
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Queue of the upstream server of the relay backend
+	Queue string `json:"queue"`
+	// URI of the ipp backend
+	URI string `json:"uri"`
+	// CRLF converts the line endings of plain text files of the appsocket backend
+	CRLF bool `json:"crlf"`
+	// Path of the directory backend or the program of the command backend
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+}
+
+// FilterConfig is either a builtin filter ("pr" or "fortran") or an external command
+type FilterConfig struct {
+	Builtin string   `json:"builtin"`
+	Path    string   `json:"path"`
+	Args    []string `json:"args"`
+	Env     []string `json:"env"`
+}
+
+type AccountingConfig struct {
+	Path string `json:"path"`
+	// Format is "bsd" or "json", defaults to bsd
+	Format string `json:"format"`
+}
+
+type MailConfig struct {
+	Addr string `json:"addr"`
+	From string `json:"from"`
+}
+
+type ACLConfig struct {
+	Hosts []string `json:"hosts"`
+	Users []string `json:"users"`
+}
+
+// Duration is a time.Duration written like "30s" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+
+	return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{Listen: ":515"}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(config); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		config.Printcap = path
+	}
+
+	names := make(map[string]bool)
+	for _, qc := range config.Queues {
+		if qc.Name == "" {
+			return nil, fmt.Errorf("%s: queue without a name", path)
+		}
+		if names[qc.Name] {
+			return nil, fmt.Errorf("%s: queue %q is declared twice", path, qc.Name)
+		}
+		names[qc.Name] = true
+	}
+
+	if config.Printcap != "" {
+		if err := config.loadPrintcap(names); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// loadPrintcap reads the printcap file of the config and takes the data file limit from its entries
+func (c *Config) loadPrintcap(names map[string]bool) error {
+	f, err := os.Open(c.Printcap)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if c.printcap, err = printcap.Parse(f); err != nil {
+		return fmt.Errorf("%s: %v", c.Printcap, err)
+	}
+
+	var maxSize int64
+	for i, e := range c.printcap.Entries {
+		p, err := e.Printer()
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.Printcap, err)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("%s: queue %q is declared twice", c.Printcap, p.Name)
+		}
+		names[p.Name] = true
+
+		// an entry without a limit makes the server unlimited
+		if i == 0 || (maxSize > 0 && (p.MaxSize == 0 || p.MaxSize > maxSize)) {
+			maxSize = p.MaxSize
+		}
+	}
+
+	if c.Limits.MaxDataFileSize == 0 {
+		c.Limits.MaxDataFileSize = maxSize
+	}
+
+	return nil
+}
+
+func (c *Config) limits() lpd.Limits {
+	return lpd.Limits{
+		MaxControlFileSize: c.Limits.MaxControlFileSize,
+		MaxDataFileSize:    c.Limits.MaxDataFileSize,
+		MaxJobSize:         c.Limits.MaxJobSize,
+		MaxDataFiles:       c.Limits.MaxDataFiles,
+		MaxSpoolSize:       c.Limits.MaxSpoolSize,
+		MaxConns:           c.Limits.MaxConns,
+		MaxConnsPerIP:      c.Limits.MaxConnsPerIP,
+	}
+}
+
+func (c *Config) timeouts() lpd.Timeouts {
+	return lpd.Timeouts{
+		Idle:            time.Duration(c.Timeouts.Idle),
+		Header:          time.Duration(c.Timeouts.Header),
+		Transfer:        time.Duration(c.Timeouts.Transfer),
+		MinTransferRate: c.Timeouts.MinTransferRate,
+		Write:           time.Duration(c.Timeouts.Write),
+	}
+}
+
+// accountingFiles keeps the accounting files open across reloads, queues which are still delivering after a
+// reload write to the same file
+type accountingFiles map[string]*os.File
+
+func (a accountingFiles) open(path string) (*os.File, error) {
+	if f, ok := a[path]; ok {
+		return f, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a[path] = f
+
+	return f, nil
+}
+
+func (a accountingFiles) close() {
+	for path, f := range a {
+		f.Close()
+		delete(a, path)
+	}
+}
+
+// queues builds the queues declared in the config file and the printcap file
+func (c *Config) queues(files accountingFiles) ([]*lpd.Queue, error) {
+	var queues []*lpd.Queue
+	for _, qc := range c.Queues {
+		q, err := qc.queue(files)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, q)
+	}
+
+	if c.printcap != nil {
+		for _, e := range c.printcap.Entries {
+			q, err := e.Queue()
+			if err != nil {
+				return nil, err
+			}
+			queues = append(queues, q)
+		}
+	}
+
+	return queues, nil
+}
+
+// queueNames returns the names of the queues declared in the config file and the printcap file
+func (c *Config) queueNames() []string {
+	var names []string
+	for _, qc := range c.Queues {
+		names = append(names, qc.Name)
+	}
+	if c.printcap != nil {
+		for _, e := range c.printcap.Entries {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names
+}
+
+// queue builds the queue declared in the config file
+func (qc QueueConfig) queue(files accountingFiles) (*lpd.Queue, error) {
+	backend, err := qc.Backend.backend()
+	if err != nil {
+		return nil, fmt.Errorf("queue %s: %v", qc.Name, err)
+	}
+
+	q := &lpd.Queue{
+		Name:          qc.Name,
+		Backend:       backend,
+		RetryInterval: time.Duration(qc.RetryInterval),
+		MaxAttempts:   qc.MaxAttempts,
+	}
+
+	if len(qc.Filters) > 0 {
+		q.Filters = make(map[lpd.OutputFormat]lpd.Filter)
+	}
+	for format, fc := range qc.Filters {
+		if len(format) != 1 || !lpd.ControlFileCommand(format[0]).IsOutputFormat() {
+			return nil, fmt.Errorf("queue %s: invalid output format %q", qc.Name, format)
+		}
+		filter, err := fc.filter()
+		if err != nil {
+			return nil, fmt.Errorf("queue %s: %v", qc.Name, err)
+		}
+		q.Filters[lpd.OutputFormat(format[0])] = filter
+	}
+
+	switch qc.Banner {
+	case "":
+	case "text":
+		q.Banner = &lpd.Banner{}
+	case "postscript":
+		q.Banner = &lpd.Banner{PostScript: true}
+	default:
+		return nil, fmt.Errorf("queue %s: unknown banner %q", qc.Name, qc.Banner)
+	}
+
+	if qc.Accounting != nil {
+		f, err := files.open(qc.Accounting.Path)
+		if err != nil {
+			return nil, fmt.Errorf("queue %s: %v", qc.Name, err)
+		}
+
+		switch qc.Accounting.Format {
+		case "", "bsd":
+			q.Accounting = &lpd.BSDAccounting{Writer: f}
+		case "json":
+			q.Accounting = &lpd.JSONAccounting{Writer: f}
+		default:
+			return nil, fmt.Errorf("queue %s: unknown accounting format %q", qc.Name, qc.Accounting.Format)
+		}
+		q.PageCounter = &lpd.PageCounter{}
+	}
+
+	if qc.Mail != nil {
+		q.Notifier = &lpd.SMTPNotifier{Addr: qc.Mail.Addr, From: qc.Mail.From}
+	}
+
+	if qc.ACL != nil {
+		q.ACL = &lpd.ACL{Hosts: qc.ACL.Hosts, Users: qc.ACL.Users}
+	}
+
+	return q, nil
+}
+
+func (bc BackendConfig) backend() (lpd.Backend, error) {
+	switch bc.Type {
+	case "relay":
+		port := bc.Port
+		if port == 0 {
+			port = 515
+		}
+		return &lpd.Relay{Client: lpd.NewClient(bc.Host, port), Queue: bc.Queue}, nil
+	case "appsocket":
+		port := bc.Port
+		if port == 0 {
+			port = lpd.DefaultAppSocketPort
+		}
+		backend := lpd.NewAppSocket(bc.Host, port)
+		backend.CRLF = bc.CRLF
+		return backend, nil
+	case "ipp":
+		return &lpd.IPP{URI: bc.URI}, nil
+	case "directory":
+		return &lpd.Directory{Path: bc.Path}, nil
+	case "command":
+		return &lpd.Command{Path: bc.Path, Args: bc.Args, Env: bc.Env}, nil
+	}
+
+	return nil, fmt.Errorf("unknown backend %q", bc.Type)
+}
+
+func (fc FilterConfig) filter() (lpd.Filter, error) {
+	switch fc.Builtin {
+	case "":
+		if fc.Path == "" {
+			return nil, fmt.Errorf("filter without a builtin or a path")
+		}
+		return &lpd.CommandFilter{Path: fc.Path, Args: fc.Args, Env: fc.Env}, nil
+	case "pr":
+		return &lpd.PRFormatter{}, nil
+	case "fortran":
+		return &lpd.FortranFormatter{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown builtin filter %q", fc.Builtin)
+}
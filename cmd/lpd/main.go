@@ -0,0 +1,217 @@
+// Command lpd runs an lpd server with the queues declared in a json config file or a printcap file, yaml and toml
+// are not supported. The aliases of a printcap entry are served as further names of its queue. It stays in the
+// foreground and logs to stderr, so it can be run by systemd as a notify service.
+//
+//	lpd [-c config] [-shutdown-timeout duration]
+//
+// SIGHUP reloads the queues of the config file, the waiting jobs and the state set with lpc move to the reloaded
+// queues, only the job which is delivered at the moment finishes with the old configuration. The listen address,
+// admin socket, spool directory, limits and timeouts are only read on start.
+// SIGINT and SIGTERM stop the server gracefully, the running transfers and delivery attempts are finished. The jobs
+// which were not delivered stay in the spool directory and are delivered after the next start, if spool_dir is set.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/phin1x/go-lpd"
+)
+
+const defaultConfigPath = "/etc/lpd.json"
+
+func main() {
+	configPath := flag.String("c", defaultConfigPath, "config `file`")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to finish running transfers and delivery attempts on stop")
+	flag.Parse()
+
+	// journald adds its own timestamps
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		log.SetFlags(0)
+	}
+
+	if err := run(*configPath, *shutdownTimeout); err != nil {
+		log.Fatalf("lpd: %v", err)
+	}
+}
+
+func run(configPath string, shutdownTimeout time.Duration) error {
+	d := &daemon{configPath: configPath, files: make(accountingFiles)}
+	defer d.files.close()
+
+	l, err := d.start()
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- d.server.Serve(l)
+	}()
+
+	if d.config.AdminSocket != "" {
+		admin, err := listenAdmin(d.config.AdminSocket)
+		if err != nil {
+			d.server.Close()
+			return err
+		}
+		defer os.Remove(d.config.AdminSocket)
+
+		go func() {
+			errs <- d.server.ServeAdmin(admin)
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	log.Printf("listening on %s", l.Addr())
+	notifySystemd("READY=1")
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				notifySystemd("RELOADING=1")
+				if err := d.reload(); err != nil {
+					log.Printf("reload failed, keeping the current config: %v", err)
+				} else {
+					log.Printf("reloaded %s", d.configPath)
+				}
+				notifySystemd("READY=1")
+				continue
+			}
+
+			log.Printf("received %s, stopping", sig)
+			notifySystemd("STOPPING=1")
+
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			err := d.server.Shutdown(ctx)
+			if err == context.DeadlineExceeded {
+				// the jobs which were not delivered stay in the spool directory
+				log.Printf("stopped after the shutdown timeout of %s", shutdownTimeout)
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+type daemon struct {
+	configPath string
+	config     *Config
+	server     *lpd.Server
+	files      accountingFiles
+}
+
+// start creates the server and its listener from the config file
+func (d *daemon) start() (net.Listener, error) {
+	config, err := loadConfig(d.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	queues, err := config.queues(d.files)
+	if err != nil {
+		return nil, err
+	}
+
+	d.config = config
+	d.server = lpd.NewServer(config.Listen)
+	d.server.SpoolDir = config.SpoolDir
+	d.server.Limits = config.limits()
+	d.server.Timeouts = config.timeouts()
+	for _, q := range queues {
+		d.server.AddQueue(q)
+	}
+
+	return net.Listen("tcp", config.Listen)
+}
+
+// reload replaces the queues of the server, the config is not changed if it contains an error
+func (d *daemon) reload() error {
+	config, err := loadConfig(d.configPath)
+	if err != nil {
+		return err
+	}
+
+	queues, err := config.queues(d.files)
+	if err != nil {
+		return err
+	}
+
+	if config.Listen != d.config.Listen || config.AdminSocket != d.config.AdminSocket ||
+		config.SpoolDir != d.config.SpoolDir || config.Limits != d.config.Limits || config.Timeouts != d.config.Timeouts {
+		log.Print("listen address, admin socket, spool directory, limits and timeouts are changed on restart only")
+	}
+
+	// the queues which are configured again take over the jobs and the state of the running queues
+	configured := make(map[string]bool)
+	for _, q := range queues {
+		d.server.ReplaceQueue(q)
+		configured[q.Name] = true
+	}
+	for _, name := range d.config.queueNames() {
+		if !configured[name] {
+			d.server.RemoveQueue(name)
+		}
+	}
+
+	config.Listen, config.AdminSocket, config.SpoolDir = d.config.Listen, d.config.AdminSocket, d.config.SpoolDir
+	config.Limits, config.Timeouts = d.config.Limits, d.config.Timeouts
+	d.config = config
+
+	return nil
+}
+
+// listenAdmin creates the admin socket, it is only accessible by the owner and the group of the daemon
+func listenAdmin(path string) (net.Listener, error) {
+	// remove the socket of a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// notifySystemd sends a state change to systemd if the daemon runs as a notify service
+func notifySystemd(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		log.Printf("could not notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprint(conn, state); err != nil {
+		log.Printf("could not notify systemd: %v", err)
+	}
+}
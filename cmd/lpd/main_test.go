@@ -0,0 +1,191 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phin1x/go-lpd"
+)
+
+const testConfig = `{
+	"listen": "127.0.0.1:0",
+	"limits": {"max_job_size": 1000, "max_conns_per_ip": 10},
+	"timeouts": {"idle": "30s"},
+	"queues": [
+		{
+			"name": "lp",
+			"backend": {"type": "directory", "path": "DIR"},
+			"filters": {"p": {"builtin": "pr"}},
+			"banner": "text",
+			"accounting": {"path": "ACCOUNTING", "format": "json"},
+			"acl": {"hosts": ["127.0.0.0/8"]}
+		}
+	]
+}`
+
+func writeConfig(t *testing.T, path, config string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lpd.json")
+	writeConfig(t, path, strings.NewReplacer("DIR", dir, "ACCOUNTING", filepath.Join(dir, "acct")).Replace(testConfig))
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("error while loading config: %v", err)
+	}
+	if config.limits().MaxJobSize != 1000 || config.timeouts().Idle != 30*time.Second {
+		t.Errorf("limits and timeouts are not correct, got %+v %+v", config.limits(), config.timeouts())
+	}
+
+	files := make(accountingFiles)
+	defer files.close()
+
+	q, err := config.Queues[0].queue(files)
+	if err != nil {
+		t.Fatalf("error while building queue: %v", err)
+	}
+	if _, ok := q.Backend.(*lpd.Directory); !ok {
+		t.Errorf("backend is not correct, got %T", q.Backend)
+	}
+	if _, ok := q.Filters[lpd.PRFormat].(*lpd.PRFormatter); !ok {
+		t.Errorf("filters are not correct, got %v", q.Filters)
+	}
+	if q.Banner == nil || q.Accounting == nil || q.ACL == nil {
+		t.Errorf("queue is not configured completely, got %+v", q)
+	}
+
+	for _, invalid := range []string{
+		`{"queues": [{"name": "lp", "backend": {"type": "fax"}}]}`,
+		`{"queues": [{"name": "lp", "backend": {"type": "directory"}, "filters": {"x": {"builtin": "pr"}}}]}`,
+		`{"queues": [{"name": "lp", "backend": {"type": "directory"}, "banner": "large"}]}`,
+	} {
+		writeConfig(t, path, invalid)
+		config, err := loadConfig(path)
+		if err != nil {
+			t.Fatalf("error while loading config: %v", err)
+		}
+		if _, err := config.Queues[0].queue(files); err == nil {
+			t.Errorf("invalid queue was accepted: %s", invalid)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"queues": [{"name": "lp"}, {"name": "lp"}]}`,
+		`{"queues": [{"backend": {"type": "directory"}}]}`,
+		`{"listen": ":515", "unknown": true}`,
+		`{"timeouts": {"idle": "soon"}}`,
+	} {
+		writeConfig(t, path, invalid)
+		if _, err := loadConfig(path); err == nil {
+			t.Errorf("invalid config was accepted: %s", invalid)
+		}
+	}
+}
+
+func TestLoadPrintcapConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "printcap")
+	writeConfig(t, path, "# printers\nlp|local:\\\n\t:rm=printserver:rp=laser:mx#100:\nnet:lp=10.0.0.1%9100:mx#50:sh:\n")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("error while loading printcap: %v", err)
+	}
+	if config.Listen != ":515" || config.limits().MaxDataFileSize != 100*1024 {
+		t.Errorf("defaults are not correct, got %q %+v", config.Listen, config.limits())
+	}
+
+	files := make(accountingFiles)
+	defer files.close()
+
+	queues, err := config.queues(files)
+	if err != nil {
+		t.Fatalf("error while building queues: %v", err)
+	}
+	if len(queues) != 2 || queues[0].Name != "lp" || queues[1].Name != "net" {
+		t.Fatalf("queues are not correct, got %+v", queues)
+	}
+	if _, ok := queues[0].Backend.(*lpd.Relay); !ok {
+		t.Errorf("backend of lp is not correct, got %T", queues[0].Backend)
+	}
+	if len(queues[0].Aliases) != 1 || queues[0].Aliases[0] != "local" {
+		t.Errorf("aliases of lp are not correct, got %v", queues[0].Aliases)
+	}
+	if _, ok := queues[1].Backend.(*lpd.AppSocket); !ok || queues[1].Banner != nil {
+		t.Errorf("net is not configured correctly, got %+v", queues[1])
+	}
+
+	// a json config serves the entries next to its own queues, the names must be unique
+	jsonPath := filepath.Join(dir, "lpd.json")
+	writeConfig(t, jsonPath, `{"printcap": "`+path+`", "limits": {"max_data_file_size": 10}, "queues": [{"name": "laser", "backend": {"type": "directory"}}]}`)
+	config, err = loadConfig(jsonPath)
+	if err != nil {
+		t.Fatalf("error while loading config: %v", err)
+	}
+	if names := config.queueNames(); len(names) != 3 || config.limits().MaxDataFileSize != 10 {
+		t.Errorf("config is not correct, got %v %+v", names, config.limits())
+	}
+
+	writeConfig(t, jsonPath, `{"printcap": "`+path+`", "queues": [{"name": "lp", "backend": {"type": "directory"}}]}`)
+	if _, err := loadConfig(jsonPath); err == nil {
+		t.Error("queue declared in both files was accepted")
+	}
+}
+
+func TestDaemonReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lpd.json")
+	writeConfig(t, path, `{"listen": "127.0.0.1:0", "queues": [{"name": "lp", "backend": {"type": "directory", "path": "`+dir+`"}}]}`)
+
+	d := &daemon{configPath: path, files: make(accountingFiles)}
+	defer d.files.close()
+
+	l, err := d.start()
+	if err != nil {
+		t.Fatalf("error while starting: %v", err)
+	}
+	go d.server.Serve(l)
+	defer d.server.Close()
+
+	writeConfig(t, path, `{"listen": "127.0.0.1:0", "queues": [{"name": "laser", "backend": {"type": "directory", "path": "`+dir+`"}}]}`)
+	if err := d.reload(); err != nil {
+		t.Fatalf("error while reloading: %v", err)
+	}
+
+	addr := l.Addr().(*net.TCPAddr)
+	client := lpd.NewClient(addr.IP.String(), addr.Port)
+	printDocument := func(queue string) error {
+		return client.PrintDocument(lpd.Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, queue, nil, lpd.PlainTextFile)
+	}
+
+	if err := printDocument("lp"); err == nil {
+		t.Error("removed queue accepted a job")
+	}
+	if err := printDocument("laser"); err != nil {
+		t.Errorf("added queue rejected a job: %v", err)
+	}
+
+	// an invalid config keeps the current queues
+	writeConfig(t, path, `{"queues": [{"name": "laser", "backend": {"type": "fax"}}]}`)
+	if err := d.reload(); err == nil {
+		t.Error("invalid config was reloaded")
+	}
+	if d.server.Queue("laser") == nil {
+		t.Error("queue was removed by an invalid config")
+	}
+}
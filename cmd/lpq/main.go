@@ -0,0 +1,160 @@
+// Command lpq shows the jobs in a print queue of an lpd server, the list can be limited to job numbers and users.
+//
+//	lpq [-P queue@host] [-l] [-a [-f file]] [--json] [job ...] [user ...]
+//
+// With -a the state of all printers in the printers file is shown, it lists one queue@host[:port] or lpd uri per line,
+// empty lines and lines starting with # are ignored. With --json the state of a printer is printed as an object,
+// with -a as a list of objects.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/phin1x/go-lpd"
+)
+
+const defaultPrintersFile = "/etc/printers"
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "lpq: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	printers []string
+	// all is set by -a, the json output is a list of printers then, even if the printers file lists only one
+	all        bool
+	long       bool
+	json       bool
+	jobNumbers []string
+	usernames  []string
+}
+
+func parseArgs(args []string, output io.Writer) (*options, error) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("lpq", flag.ContinueOnError)
+	fs.SetOutput(output)
+	printer := fs.String("P", os.Getenv("PRINTER"), "printer `queue@host` or lpd uri, defaults to $PRINTER")
+	fs.BoolVar(&opts.all, "a", false, "show all printers of the printers file")
+	printersFile := fs.String("f", defaultPrintersFile, "printers `file` used by -a")
+	fs.BoolVar(&opts.long, "l", false, "show the long format")
+	fs.BoolVar(&opts.json, "json", false, "print the parsed queue state as json")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	opts.printers = []string{*printer}
+	if opts.all {
+		printers, err := readPrintersFile(*printersFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.printers = printers
+	}
+
+	for _, arg := range fs.Args() {
+		if _, err := strconv.Atoi(arg); err == nil {
+			opts.jobNumbers = append(opts.jobNumbers, arg)
+		} else {
+			opts.usernames = append(opts.usernames, arg)
+		}
+	}
+
+	return opts, nil
+}
+
+// readPrintersFile reads the printers listed in a printers file
+func readPrintersFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var printers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			printers = append(printers, line)
+		}
+	}
+
+	return printers, scanner.Err()
+}
+
+// printerState is the json output for a printer
+type printerState struct {
+	Printer string `json:"printer"`
+	*lpd.QueueState
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	opts, err := parseArgs(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	states := []printerState{}
+	for _, printer := range opts.printers {
+		target, err := lpd.ParsePrinter(printer)
+		if err != nil {
+			return err
+		}
+		client, queue := target.Client(), target.Queue
+
+		if !opts.json {
+			if opts.all {
+				fmt.Fprintf(stdout, "%s@%s:\n", queue, target.Host)
+			}
+			if err := writeState(stdout, client, queue, opts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		state, err := client.GetQueueState(queue, opts.long, opts.jobNumbers, opts.usernames)
+		if err != nil {
+			return err
+		}
+		states = append(states, printerState{Printer: queue + "@" + target.Host, QueueState: state})
+	}
+
+	if !opts.json {
+		return nil
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if !opts.all {
+		return enc.Encode(states[0])
+	}
+
+	return enc.Encode(states)
+}
+
+func writeState(w io.Writer, client *lpd.Client, queue string, opts *options) error {
+	getState := client.GetQueueStateShort
+	if opts.long {
+		getState = client.GetQueueStateLong
+	}
+
+	state, err := getState(queue, opts.jobNumbers, opts.usernames)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, state)
+	return err
+}
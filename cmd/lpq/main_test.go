@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-lpd"
+	"github.com/phin1x/go-lpd/lpdtest"
+)
+
+// the queue state answers of a queue holding a job of alice and bob each
+const (
+	shortState = "lp is ready and printing\n" +
+		"Rank   Owner      Job  Files                                 Total Size\n" +
+		"active alice      1    alice.txt                             4 bytes\n" +
+		"2nd    bob        2    bob.txt                               4 bytes\n"
+	longState = "lp is ready and printing\n" +
+		"\nalice: active                            [job 001host]\n" +
+		"\talice.txt                        4 bytes\n" +
+		"\nbob: 2nd                                 [job 002host]\n" +
+		"\tbob.txt                          4 bytes\n"
+)
+
+func TestLpq(t *testing.T) {
+	srv := lpdtest.NewServer()
+	defer srv.Close()
+	srv.SetQueueState(shortState)
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-P", "lp@" + srv.Addr, "bob"}, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+	if out.String() != shortState {
+		t.Errorf("queue state is not written as received, got %q", out.String())
+	}
+	if commands := srv.Commands(); len(commands) != 1 || commands[0].Daemon.Command != lpd.QueueStatsShort ||
+		strings.Join(commands[0].Daemon.List, " ") != "bob" {
+		t.Errorf("queue state command is not correct, got %+v", commands)
+	}
+
+	srv.SetQueueState(longState)
+	out.Reset()
+	if err := run([]string{"-P", "lp@" + srv.Addr, "-l", "--json"}, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+
+	var state printerState
+	if err := json.Unmarshal(out.Bytes(), &state); err != nil {
+		t.Fatalf("output is not valid json: %v\n%s", err, out.String())
+	}
+	if state.Printer != "lp@"+srv.Addr[:strings.LastIndex(srv.Addr, ":")] || len(state.Jobs) != 2 {
+		t.Fatalf("queue state is not correct, got %+v", state)
+	}
+	if job := state.Jobs[0]; job.Owner != "alice" || job.Rank != "active" || len(job.Files) != 1 || job.Size != 4 {
+		t.Errorf("job is not parsed correctly, got %+v", job)
+	}
+}
+
+func TestLpqAll(t *testing.T) {
+	lp := lpdtest.NewServer()
+	defer lp.Close()
+	lp.SetQueueState(shortState)
+
+	laser := lpdtest.NewServer()
+	defer laser.Close()
+	laser.SetQueueState("laser is ready\nno entries\n")
+
+	printers := filepath.Join(t.TempDir(), "printers")
+	content := "# all printers\nlp@" + lp.Addr + "\n\nlaser@" + laser.Addr + "\n"
+	if err := ioutil.WriteFile(printers, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write printers file: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-a", "-f", printers, "--json"}, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+
+	var states []printerState
+	if err := json.Unmarshal(out.Bytes(), &states); err != nil {
+		t.Fatalf("output is not valid json: %v\n%s", err, out.String())
+	}
+	if len(states) != 2 || len(states[0].Jobs) != 2 || len(states[1].Jobs) != 0 {
+		t.Errorf("queue states are not correct, got %+v", states)
+	}
+
+	// the output of -a is a list, even for a single printer
+	if err := ioutil.WriteFile(printers, []byte("lp@"+lp.Addr+"\n"), 0644); err != nil {
+		t.Fatalf("could not write printers file: %v", err)
+	}
+	out.Reset()
+	if err := run([]string{"-a", "-f", printers, "--json"}, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+	states = nil
+	if err := json.Unmarshal(out.Bytes(), &states); err != nil || len(states) != 1 {
+		t.Errorf("output is not a list of one printer: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,200 @@
+// Command lpr sends files to a print queue of an lpd server, it reads the standard input if no file is given.
+// Several files are sent as one job.
+//
+// The destination is given as queue@host:port or as lpd://host:port/queue?format=o&banner=false uri.
+//
+//	lpr [-P queue@host] [-#copies] [-J job] [-T title] [-m] [-h] [-l | -p | -o] [file ...]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+
+	"github.com/phin1x/go-lpd"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "lpr: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	printer  string
+	copies   int
+	job      string
+	title    string
+	mail     bool
+	noBanner bool
+	format   lpd.OutputFormat
+	files    []string
+}
+
+func parseArgs(args []string, output io.Writer) (*options, error) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("lpr", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.printer, "P", os.Getenv("PRINTER"), "destination `queue@host` or lpd uri, defaults to $PRINTER")
+	fs.IntVar(&opts.copies, "#", 1, "number of `copies`")
+	fs.StringVar(&opts.job, "J", "", "`job` name printed on the banner page")
+	fs.StringVar(&opts.title, "T", "", "`title` used by pr instead of the file name")
+	fs.BoolVar(&opts.mail, "m", false, "send mail when the job is finished")
+	fs.BoolVar(&opts.noBanner, "h", false, "do not print a banner page")
+	leaveControl := fs.Bool("l", false, "print control characters and suppress page breaks")
+	pr := fs.Bool("p", false, "format the files with pr")
+	postScript := fs.Bool("o", false, "the files are postscript")
+
+	if err := fs.Parse(expandCopies(args)); err != nil {
+		return nil, err
+	}
+
+	formats := 0
+	for format, set := range map[lpd.OutputFormat]bool{
+		lpd.PrintWithLeavingControlCharacters: *leaveControl,
+		lpd.PRFormat:                          *pr,
+		lpd.PostscriptFile:                    *postScript,
+	} {
+		if set {
+			opts.format = format
+			formats++
+		}
+	}
+	if formats > 1 {
+		return nil, errors.New("only one of -l, -p and -o may be given")
+	}
+
+	if opts.copies < 1 {
+		return nil, fmt.Errorf("invalid number of copies %d", opts.copies)
+	}
+
+	opts.files = fs.Args()
+
+	return opts, nil
+}
+
+// expandCopies splits the bsd form -#N into -# N, the flag package would take #N as the flag name
+func expandCopies(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-#") && len(arg) > 2 && arg[2] != '=' {
+			expanded = append(expanded, "-#", arg[2:])
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+
+	return expanded
+}
+
+func run(args []string, stdin io.Reader, stderr io.Writer) error {
+	opts, err := parseArgs(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	target, err := lpd.ParsePrinter(opts.printer)
+	if err != nil {
+		return err
+	}
+	client, queue := target.Client(), target.Queue
+
+	// the options of the flags take precedence over the options of the target uri
+	if opts.format == 0 {
+		opts.format = target.Format
+	}
+	opts.noBanner = opts.noBanner || !target.Banner
+
+	if len(opts.files) == 0 {
+		return printStdin(client, queue, opts, stdin)
+	}
+
+	return printFiles(client, queue, opts, opts.files)
+}
+
+// printFiles sends the files as one job, like bsd lpr does
+func printFiles(client *lpd.Client, queue string, opts *options, files []string) error {
+	docs := make([]lpd.Document, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		docs = append(docs, lpd.Document{
+			Document: f,
+			Size:     int(stat.Size()),
+			Name:     path.Base(file),
+		})
+	}
+
+	return printDocuments(client, queue, opts, docs)
+}
+
+// printStdin buffers the standard input in a temporary file, because the size has to be sent first
+func printStdin(client *lpd.Client, queue string, opts *options, stdin io.Reader) error {
+	f, err := ioutil.TempFile("", "lpr")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, stdin)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return printDocuments(client, queue, opts, []lpd.Document{{
+		Document: f,
+		Size:     int(size),
+		Name:     "standard input",
+	}})
+}
+
+func printDocuments(client *lpd.Client, queue string, opts *options, docs []lpd.Document) error {
+	cf := lpd.ControlFile{}
+	if opts.job != "" {
+		cf[lpd.JobName] = opts.job
+	}
+	if opts.format == lpd.PRFormat {
+		// the control file holds one title for all files, so the file name is the title of a single file only
+		if opts.title != "" {
+			cf[lpd.Title] = opts.title
+		} else if len(docs) == 1 {
+			cf[lpd.Title] = docs[0].Name
+		}
+	}
+	if opts.mail {
+		currentUser, err := user.Current()
+		if err != nil {
+			return err
+		}
+		cf[lpd.MailWhenPrinted] = currentUser.Username
+	}
+
+	return client.PrintDocumentsWithOptions(docs, queue, cf, opts.format, lpd.PrintOptions{
+		Copies:   opts.copies,
+		NoBanner: opts.noBanner,
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-lpd"
+	"github.com/phin1x/go-lpd/lpdtest"
+)
+
+// receivedJob returns the only job the server received, the data files are listed with their size
+func receivedJob(t *testing.T, srv *lpdtest.Server) *lpd.Job {
+	t.Helper()
+
+	controlFiles := srv.ControlFiles()
+	if len(controlFiles) != 1 {
+		t.Fatalf("expected one job, got %d control files", len(controlFiles))
+	}
+
+	job := &lpd.Job{ControlFile: controlFiles[0].ControlFile, RawControlFile: controlFiles[0].Data}
+	for _, f := range srv.DataFiles() {
+		job.DataFiles = append(job.DataFiles, &lpd.DataFile{Name: f.Name, Size: int64(len(f.Data))})
+	}
+
+	return job
+}
+
+func TestLprStdin(t *testing.T) {
+	srv := lpdtest.NewServer()
+	defer srv.Close()
+
+	err := run([]string{"-P", "lp@" + srv.Addr, "-#", "2", "-J", "report", "-h", "-p", "-T", "Monthly"}, strings.NewReader("hello"), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("error while printing: %v", err)
+	}
+
+	job := receivedJob(t, srv)
+
+	if len(job.DataFiles) != 1 || job.DataFiles[0].Size != 5 {
+		t.Fatalf("standard input was not sent, got %v", job.DataFiles)
+	}
+	if lines := job.PrintLines(); len(lines) != 2 || lines[0].Format != lpd.PRFormat {
+		t.Errorf("print lines are not correct, got %v", lines)
+	}
+	if _, ok := job.ControlFile[lpd.PrintBanner]; ok {
+		t.Error("banner was requested")
+	}
+	for cmd, value := range map[lpd.ControlFileCommand]string{lpd.JobName: "report", lpd.Title: "Monthly"} {
+		if job.ControlFile[cmd] != value {
+			t.Errorf("control file command %c is not correct, expected %q, got %q", cmd, value, job.ControlFile[cmd])
+		}
+	}
+}
+
+func TestLprFiles(t *testing.T) {
+	srv := lpdtest.NewServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.ps", "b.ps"} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte("%!PS"), 0644); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	os.Setenv("PRINTER", "lp@"+srv.Addr)
+	defer os.Unsetenv("PRINTER")
+
+	if err := run(append([]string{"-o", "-#2"}, files...), nil, ioutil.Discard); err != nil {
+		t.Fatalf("error while printing: %v", err)
+	}
+
+	// the files are sent as one job with two copies of each file
+	job := receivedJob(t, srv)
+	if len(job.DataFiles) != 2 {
+		t.Fatalf("files were not sent as one job, got %v", job.DataFiles)
+	}
+	lines := job.PrintLines()
+	if len(lines) != 4 || lines[0].File != lines[1].File || lines[2].File != lines[3].File || lines[0].File == lines[2].File {
+		t.Fatalf("print lines are not correct, got %v", lines)
+	}
+	for _, line := range lines {
+		if line.Format != lpd.PostscriptFile || job.DataFile(line.File) == nil {
+			t.Errorf("print line is not correct, got %v", line)
+		}
+	}
+	if job.ControlFile[lpd.JobName] != "a.ps" {
+		t.Errorf("job name is not the first file name, got %q", job.ControlFile[lpd.JobName])
+	}
+	if job.ControlFile[lpd.PrintBanner] == "" {
+		t.Error("banner was not requested")
+	}
+}
+
+func TestLprArgs(t *testing.T) {
+	for _, args := range [][]string{{"-l", "-o"}, {"-#", "0"}, {"-#0"}, {"-x"}} {
+		if _, err := parseArgs(args, ioutil.Discard); err == nil {
+			t.Errorf("invalid arguments %v were accepted", args)
+		}
+	}
+
+	opts, err := parseArgs([]string{"-#3", "file"}, ioutil.Discard)
+	if err != nil || opts.copies != 3 || len(opts.files) != 1 {
+		t.Errorf("attached number of copies is not parsed correctly, got %+v %v", opts, err)
+	}
+}
@@ -0,0 +1,109 @@
+// Command lprm removes jobs from a print queue of an lpd server.
+//
+//	lprm [-P queue@host] [-U agent] [-n] [-] [job ...] [user ...]
+//
+// Without a job number or user the active job is removed, - removes all jobs of the agent. Only root may
+// remove the jobs of other users. With -n the jobs which would be removed are listed instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/phin1x/go-lpd"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "lprm: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	printer    string
+	agent      string
+	dryRun     bool
+	jobNumbers []string
+	usernames  []string
+}
+
+func parseArgs(args []string, output io.Writer) (*options, error) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("lprm", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.printer, "P", os.Getenv("PRINTER"), "printer `queue@host` or lpd uri, defaults to $PRINTER")
+	fs.StringVar(&opts.agent, "U", "", "`agent` name sent to the server, defaults to the current user")
+	fs.BoolVar(&opts.dryRun, "n", false, "list the jobs which would be removed")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.agent == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		opts.agent = currentUser.Username
+	}
+
+	for _, arg := range fs.Args() {
+		if arg == "-" {
+			opts.usernames = append(opts.usernames, opts.agent)
+		} else if _, err := strconv.Atoi(arg); err == nil {
+			opts.jobNumbers = append(opts.jobNumbers, arg)
+		} else {
+			opts.usernames = append(opts.usernames, arg)
+		}
+	}
+
+	return opts, nil
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	opts, err := parseArgs(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	target, err := lpd.ParsePrinter(opts.printer)
+	if err != nil {
+		return err
+	}
+	client, queue := target.Client(), target.Queue
+
+	if opts.dryRun {
+		return listMatches(stdout, client, queue, opts)
+	}
+
+	return client.RemoveJobs(queue, opts.agent, opts.jobNumbers, opts.usernames)
+}
+
+// listMatches queries the queue state and lists the jobs the server would remove
+func listMatches(w io.Writer, client *lpd.Client, queue string, opts *options) error {
+	state, err := client.GetQueueState(queue, false, opts.jobNumbers, opts.usernames)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range state.Jobs {
+		if len(opts.jobNumbers) == 0 && len(opts.usernames) == 0 && job.Rank != "active" {
+			continue
+		}
+		if opts.agent != "root" && opts.agent != job.Owner {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s: job %03d of %s (%s) would be removed\n", queue, job.Number, job.Owner, job.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-lpd"
+	"github.com/phin1x/go-lpd/lpdtest"
+)
+
+// queueState is the answer of a queue holding two jobs of alice and one of bob
+const queueState = "lp is ready and printing\n" +
+	"Rank   Owner      Job  Files                                 Total Size\n" +
+	"active alice      1    alice.txt                             4 bytes\n" +
+	"2nd    bob        2    bob.txt                               4 bytes\n" +
+	"3rd    alice      3    alice.txt                             4 bytes\n"
+
+func TestLprmDryRun(t *testing.T) {
+	srv := lpdtest.NewServer()
+	defer srv.Close()
+	srv.SetQueueState(queueState)
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"-P", "lp@" + srv.Addr, "-U", "alice", "-n", "-"}, out, ioutil.Discard); err != nil {
+		t.Fatalf("error while listing jobs: %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], "alice") {
+		t.Errorf("matched jobs are not correct, got %q", out.String())
+	}
+	for _, cmd := range srv.Commands() {
+		if cmd.Daemon.Command == lpd.RemoveJobs {
+			t.Error("dry run removed jobs")
+		}
+	}
+}
+
+func TestLprm(t *testing.T) {
+	srv := lpdtest.NewServer()
+	defer srv.Close()
+
+	for _, args := range [][]string{{"-U", "bob", "alice"}, {"-U", "alice", "-", "3"}} {
+		if err := run(append([]string{"-P", "lp@" + srv.Addr}, args...), ioutil.Discard, ioutil.Discard); err != nil {
+			t.Fatalf("error while removing jobs: %v", err)
+		}
+	}
+
+	// the user names are sent in front of the job numbers, - is the agent
+	commands := srv.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("expected two remove commands, got %+v", commands)
+	}
+	for i, expected := range [][2]string{{"bob", "alice"}, {"alice", "alice 3"}} {
+		cmd := commands[i].Daemon
+		if cmd.Command != lpd.RemoveJobs || cmd.Queue != "lp" || cmd.Agent != expected[0] || strings.Join(cmd.List, " ") != expected[1] {
+			t.Errorf("remove command is not correct, got %+v", cmd)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lpd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// controlFileEnv names the environment variables for the control file commands passed to external commands
+var controlFileEnv = map[ControlFileCommand]string{
+	BannerClass:     "LPD_CLASS",
+	Hostname:        "LPD_HOST",
+	Indent:          "LPD_INDENT",
+	JobName:         "LPD_JOB_NAME",
+	PrintBanner:     "LPD_BANNER_USER",
+	MailWhenPrinted: "LPD_MAIL",
+	SourceFileName:  "LPD_SOURCE_FILE",
+	UserID:          "LPD_USER",
+	Title:           "LPD_TITLE",
+	WidthOfOutput:   "LPD_WIDTH",
+}
+
+// Command is a backend which pipes every data file of a job into an external command, like the input filter of
+// the bsd lpd. The job attributes are passed as environment variables, see JobEnv. The job failed if the command
+// exits with a non zero status, a retry only runs the command for the print lines which failed before.
+type Command struct {
+	Path string
+	Args []string
+	// Env is appended to the environment of the server process and the job attributes
+	Env []string
+	Dir string
+}
+
+func (c *Command) Deliver(job *Job) error {
+	for i, line := range job.PrintLines() {
+		df := job.DataFile(line.File)
+		if df == nil || job.isDelivered(i) {
+			continue
+		}
+
+		if err := c.run(job, line, df); err != nil {
+			return err
+		}
+		job.setDelivered(i)
+	}
+
+	return nil
+}
+
+func (c *Command) run(job *Job, line PrintLine, df *DataFile) error {
+	f, err := df.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Stdin = f
+	cmd.Stderr = stderr
+	cmd.Dir = c.Dir
+	cmd.Env = append(append(os.Environ(), JobEnv(job, line)...), c.Env...)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("command %s failed: %v: %s", c.Path, err, msg)
+		}
+		return fmt.Errorf("command %s failed: %v", c.Path, err)
+	}
+
+	return nil
+}
+
+// JobEnv returns the environment variables which describe a print line of a job
+func JobEnv(job *Job, line PrintLine) []string {
+	env := []string{
+		"LPD_QUEUE=" + job.Queue,
+		"LPD_JOB_NUMBER=" + strconv.Itoa(job.Number),
+		"LPD_CONTROL_FILE=" + job.ControlFileName,
+		"LPD_REMOTE_ADDR=" + job.RemoteAddr,
+		"LPD_FORMAT=" + string(line.Format),
+		"LPD_DATA_FILE=" + line.File,
+	}
+
+	if df := job.DataFile(line.File); df != nil {
+		env = append(env, "LPD_DATA_SIZE="+strconv.FormatInt(df.Size, 10))
+	}
+
+	for cmd, name := range controlFileEnv {
+		if value, ok := job.ControlFile[cmd]; ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,191 @@
+package lpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxCommandLineLength limits a command line including the command code and the line ending, like the line buffer
+// of the bsd lpd
+const MaxCommandLineLength = 1024
+
+var (
+	// ErrLineTooLong is returned for command lines longer than MaxCommandLineLength
+	ErrLineTooLong = errors.New("command line too long")
+	// ErrMalformedCommand is returned for command lines which do not follow RFC 1179
+	ErrMalformedCommand = errors.New("malformed command line")
+)
+
+// DaemonCommandLine is the first command line a client sends on a connection
+type DaemonCommandLine struct {
+	Command DaemonCommand
+	Queue   string
+	// Agent is the user name making a remove jobs request
+	Agent string
+	// List holds the user names and job numbers of the queue state and remove jobs commands
+	List []string
+}
+
+// SubCommandLine is a command line sent after a receive job command
+type SubCommandLine struct {
+	Command SubCommand
+	// Count is the announced size of a control or data file
+	Count int64
+	// Name is the name of a control or data file, like cfA001host
+	Name string
+}
+
+// ReadDaemonCommand reads and parses a daemon command line
+func ReadDaemonCommand(r *bufio.Reader) (*DaemonCommandLine, error) {
+	line, err := readCommandLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDaemonCommand(line)
+}
+
+// ReadSubCommand reads and parses a sub command line of a receive job command
+func ReadSubCommand(r *bufio.Reader) (*SubCommandLine, error) {
+	line, err := readCommandLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSubCommand(line)
+}
+
+// ParseDaemonCommand parses a daemon command line without the line ending
+func ParseDaemonCommand(line string) (*DaemonCommandLine, error) {
+	code, operands, err := splitCommandLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &DaemonCommandLine{Command: DaemonCommand(code)}
+
+	switch cmd.Command {
+	case PrintJobs, ReceiveJob:
+		if len(operands) != 1 {
+			return nil, malformed("command %#x takes only a queue", code)
+		}
+	case QueueStatsShort, QueueStatsLong:
+		if len(operands) < 1 {
+			return nil, malformed("command %#x has no queue", code)
+		}
+		cmd.List = operands[1:]
+	case RemoveJobs:
+		if len(operands) < 2 {
+			return nil, malformed("command %#x has no queue or agent", code)
+		}
+		cmd.Agent, cmd.List = operands[1], operands[2:]
+	default:
+		return nil, malformed("unknown daemon command %#x", code)
+	}
+	cmd.Queue = operands[0]
+
+	return cmd, nil
+}
+
+// ParseSubCommand parses a sub command line of a receive job command without the line ending
+func ParseSubCommand(line string) (*SubCommandLine, error) {
+	code, operands, err := splitCommandLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &SubCommandLine{Command: SubCommand(code)}
+
+	switch cmd.Command {
+	case AbortJob:
+		if len(operands) != 0 {
+			return nil, malformed("command %#x takes no operands", code)
+		}
+		return cmd, nil
+	case SendControlFile, SendDataFile:
+	default:
+		return nil, malformed("unknown sub command %#x", code)
+	}
+
+	if len(operands) != 2 {
+		return nil, malformed("command %#x takes a count and a name", code)
+	}
+	if cmd.Count, err = parseCount(operands[0]); err != nil {
+		return nil, err
+	}
+	if strings.Contains(operands[1], "/") {
+		return nil, malformed("invalid file name %q", operands[1])
+	}
+	cmd.Name = operands[1]
+
+	return cmd, nil
+}
+
+// readCommandLine reads a command line up to the line ending, which is not returned
+func readCommandLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice(LineEnding[0])
+		if len(line)+len(chunk) > MaxCommandLineLength {
+			return "", ErrLineTooLong
+		}
+		line = append(line, chunk...)
+
+		switch err {
+		case nil:
+			return string(line[:len(line)-1]), nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		return "", err
+	}
+}
+
+// splitCommandLine splits a command line into the command code and the operands, which are separated by spaces or
+// tabs. A carriage return before the line ending is accepted, other control characters are rejected.
+func splitCommandLine(line string) (byte, []string, error) {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) == 0 {
+		return 0, nil, malformed("empty command line")
+	}
+
+	for i := 1; i < len(line); i++ {
+		if c := line[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return 0, nil, malformed("invalid character %#x", c)
+		}
+	}
+
+	operands := strings.FieldsFunc(line[1:], func(r rune) bool {
+		return r == ' ' || r == '\t'
+	})
+
+	return line[0], operands, nil
+}
+
+// parseCount parses the decimal file size of a sub command
+func parseCount(s string) (int64, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, malformed("invalid count %q", s)
+		}
+	}
+
+	count, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, malformed("invalid count %q", s)
+	}
+
+	return count, nil
+}
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformedCommand, fmt.Sprintf(format, args...))
+}
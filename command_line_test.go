@@ -0,0 +1,174 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDaemonCommand(t *testing.T) {
+	testCases := []struct {
+		Line     string
+		Expected DaemonCommandLine
+	}{
+		{Line: "\x01lp", Expected: DaemonCommandLine{Command: PrintJobs, Queue: "lp"}},
+		{Line: "\x02lp\r", Expected: DaemonCommandLine{Command: ReceiveJob, Queue: "lp"}},
+		{Line: "\x03lp", Expected: DaemonCommandLine{Command: QueueStatsShort, Queue: "lp", List: []string{}}},
+		{Line: "\x04lp alice\t7 ", Expected: DaemonCommandLine{Command: QueueStatsLong, Queue: "lp", List: []string{"alice", "7"}}},
+		{Line: "\x05lp root  alice 7", Expected: DaemonCommandLine{Command: RemoveJobs, Queue: "lp", Agent: "root", List: []string{"alice", "7"}}},
+	}
+
+	for _, c := range testCases {
+		cmd, err := ParseDaemonCommand(c.Line)
+		if err != nil {
+			t.Errorf("%q: error while parsing: %v", c.Line, err)
+			continue
+		}
+		if !reflect.DeepEqual(*cmd, c.Expected) {
+			t.Errorf("%q: expected %+v, got %+v", c.Line, c.Expected, *cmd)
+		}
+	}
+
+	for _, invalid := range []string{"", "\x01", "\x01 ", "\x02lp lp", "\x05lp", "\x06lp", "\x03l\x00p", "\x03lp\x7f", "\x03lp\ralice"} {
+		if cmd, err := ParseDaemonCommand(invalid); !errors.Is(err, ErrMalformedCommand) {
+			t.Errorf("invalid line %q was not rejected, got %+v, %v", invalid, cmd, err)
+		}
+	}
+}
+
+func TestParseSubCommand(t *testing.T) {
+	testCases := []struct {
+		Line     string
+		Expected SubCommandLine
+	}{
+		{Line: "\x01", Expected: SubCommandLine{Command: AbortJob}},
+		{Line: "\x0242 cfA001host", Expected: SubCommandLine{Command: SendControlFile, Count: 42, Name: "cfA001host"}},
+		{Line: "\x030 dfA001host", Expected: SubCommandLine{Command: SendDataFile, Name: "dfA001host"}},
+	}
+
+	for _, c := range testCases {
+		cmd, err := ParseSubCommand(c.Line)
+		if err != nil {
+			t.Errorf("%q: error while parsing: %v", c.Line, err)
+			continue
+		}
+		if *cmd != c.Expected {
+			t.Errorf("%q: expected %+v, got %+v", c.Line, c.Expected, *cmd)
+		}
+	}
+
+	for _, invalid := range []string{
+		"", "\x01 x", "\x02", "\x0242", "\x02-1 cfA001host", "\x02+1 cfA001host", "\x03a dfA001host",
+		"\x0399999999999999999999 dfA001host", "\x031 ../dfA001host", "\x031 dfA001host x", "\x04",
+	} {
+		if cmd, err := ParseSubCommand(invalid); !errors.Is(err, ErrMalformedCommand) {
+			t.Errorf("invalid line %q was not rejected, got %+v, %v", invalid, cmd, err)
+		}
+	}
+}
+
+func TestReadCommandLine(t *testing.T) {
+	long := "\x03lp " + strings.Repeat("alice ", MaxCommandLineLength)
+
+	// a small buffer checks lines which are read in several chunks
+	r := bufio.NewReaderSize(strings.NewReader("\x03lp "+strings.Repeat("a", 100)+"\n"+long+"\n"), 16)
+
+	cmd, err := ReadDaemonCommand(r)
+	if err != nil || len(cmd.List) != 1 || len(cmd.List[0]) != 100 {
+		t.Errorf("line is not read correctly, got %+v, %v", cmd, err)
+	}
+	if _, err := ReadDaemonCommand(r); err != ErrLineTooLong {
+		t.Errorf("expected %v, got %v", ErrLineTooLong, err)
+	}
+
+	if _, err := ReadSubCommand(bufio.NewReader(strings.NewReader(""))); err != io.EOF {
+		t.Errorf("expected %v, got %v", io.EOF, err)
+	}
+	if _, err := ReadSubCommand(bufio.NewReader(strings.NewReader("\x01"))); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestServerMalformedCommand(t *testing.T) {
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	for _, line := range []string{"\x02lp lp\n", "\x02\n", strings.Repeat("\x02", MaxCommandLineLength+1)} {
+		session, err := client.Dial()
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+
+		if err := session.SendCommand(line[0], line[1:len(line)-1]); err != nil {
+			t.Fatalf("could not send command: %v", err)
+		}
+		if err := session.CheckAcknowledge(); err == nil {
+			t.Errorf("malformed command %q was acknowledged", line)
+		}
+
+		session.Close()
+	}
+}
+
+// FuzzParseDaemonCommand checks that a parsed daemon command is written and parsed again to the same command
+func FuzzParseDaemonCommand(f *testing.F) {
+	for _, seed := range []string{"\x01lp", "\x02lp", "\x03lp alice 7", "\x04lp", "\x05lp root alice 7", "\x03lp\t\r"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		cmd, err := ParseDaemonCommand(line)
+		if err != nil {
+			if !errors.Is(err, ErrMalformedCommand) {
+				t.Fatalf("unexpected error type: %v", err)
+			}
+			return
+		}
+
+		operands := []string{cmd.Queue}
+		if cmd.Command == RemoveJobs {
+			operands = append(operands, cmd.Agent)
+		}
+		operands = append(operands, cmd.List...)
+
+		buf := new(bytes.Buffer)
+		if err := SendCommandLine(buf, byte(cmd.Command), operands); err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := ReadDaemonCommand(bufio.NewReader(buf))
+		if err != nil && len(line) < MaxCommandLineLength {
+			t.Fatalf("written command %q is not parsed: %v", buf.String(), err)
+		}
+		if err == nil && !reflect.DeepEqual(parsed, cmd) {
+			t.Fatalf("expected %+v, got %+v", cmd, parsed)
+		}
+	})
+}
+
+// FuzzReadSubCommand reads sub commands from a stream until it fails
+func FuzzReadSubCommand(f *testing.F) {
+	for _, seed := range []string{"\x01\n", "\x0242 cfA001host\n\x030 dfA001host\n", "\x031 dfA001host\r\n\x01"} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		for {
+			cmd, err := ReadSubCommand(r)
+			if err != nil {
+				return
+			}
+
+			if cmd.Count < 0 || strings.ContainsAny(cmd.Name, "/ \t\r\n") {
+				t.Fatalf("invalid sub command %+v", cmd)
+			}
+			if cmd.Command != AbortJob && cmd.Command != SendControlFile && cmd.Command != SendDataFile {
+				t.Fatalf("unknown sub command %+v", cmd)
+			}
+		}
+	})
+}
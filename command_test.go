@@ -0,0 +1,69 @@
+package lpd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandDeliver(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	job := newTestJob(t, "hello world")
+
+	backend := &Command{
+		Path: "/bin/sh",
+		Args: []string{"-c", `{ echo "$LPD_USER $LPD_JOB_NAME $LPD_FORMAT"; cat; } > "$OUT"`},
+		Env:  []string{"OUT=" + out},
+	}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while delivering job: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("could not read command output: %v", err)
+	}
+	if expected := "alice report f\nhello world"; string(content) != expected {
+		t.Errorf("command output is not correct, expected %q, got %q", expected, content)
+	}
+
+	backend = &Command{Path: "/bin/sh", Args: []string{"-c", "echo out of paper >&2; exit 3"}}
+	err = backend.Deliver(newTestJob(t, "hello world"))
+	if err == nil || !strings.Contains(err.Error(), "out of paper") {
+		t.Errorf("expected an error with the command output, got %v", err)
+	}
+}
+
+func TestCommandRetry(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	job := newTestJob(t, "page")
+	job.RawControlFile = []byte("Halice\nfdfA007host\nldfA007host\n")
+
+	// the command fails for the second print line until the marker file exists
+	marker := filepath.Join(t.TempDir(), "ready")
+	backend := &Command{
+		Path: "/bin/sh",
+		Args: []string{"-c", `if [ "$LPD_FORMAT" = l ] && [ ! -e "$MARKER" ]; then exit 1; fi; echo "$LPD_FORMAT" >> "$OUT"`},
+		Env:  []string{"OUT=" + out, "MARKER=" + marker},
+	}
+	if err := backend.Deliver(job); err == nil {
+		t.Fatal("expected an error for the second print line")
+	}
+
+	if err := ioutil.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatalf("could not write marker: %v", err)
+	}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while retrying job: %v", err)
+	}
+
+	// the retry runs the command only for the print line which failed
+	content, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("could not read command output: %v", err)
+	}
+	if string(content) != "f\nl\n" {
+		t.Errorf("command output is not correct, expected %q, got %q", "f\nl\n", content)
+	}
+}
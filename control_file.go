@@ -8,6 +8,25 @@ import (
 
 type ControlFile map[ControlFileCommand]string
 
+var outputFormats = map[OutputFormat]bool{
+	CIFFile:                           true,
+	DVIFile:                           true,
+	PlainTextFile:                     true,
+	PlotFile:                          true,
+	PrintWithLeavingControlCharacters: true,
+	DitroffFile:                       true,
+	PostscriptFile:                    true,
+	PRFormat:                          true,
+	FortranCarriageControlFormat:      true,
+	TroffFormat:                       true,
+	RasterFormat:                      true,
+}
+
+// IsOutputFormat reports whether the command prints a data file in one of the output formats
+func (c ControlFileCommand) IsOutputFormat() bool {
+	return outputFormats[OutputFormat(c)]
+}
+
 func (c *ControlFile) Encode() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
@@ -58,13 +77,13 @@ type ControlFileDecoder struct {
 }
 
 func (c *ControlFileDecoder) Decode(size int) (ControlFile, error) {
-	data := make([]byte, size)
-	readed, err := c.reader.Read(data)
-	if err != nil {
-		return nil, err
+	if size < 0 {
+		return nil, fmt.Errorf("invalid control file size %d", size)
 	}
-	if readed != size {
-		return nil, fmt.Errorf("could not read %d bytes from reader", size)
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return nil, fmt.Errorf("could not read %d bytes from reader: %v", size, err)
 	}
 
 	cf := ControlFile{}
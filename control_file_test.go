@@ -112,3 +112,37 @@ func TestControlFileeDecoding(t *testing.T) {
 		buf.Reset()
 	}
 }
+
+// FuzzControlFileDecoder checks that a decoded control file is encoded and decoded again to the same control file
+func FuzzControlFileDecoder(f *testing.F) {
+	for _, c := range decodingTestCases {
+		f.Add(c.Bytes, len(c.Bytes))
+	}
+	f.Add([]byte("Halice"), 7)
+	f.Add([]byte("Halice"), -1)
+
+	f.Fuzz(func(t *testing.T, data []byte, size int) {
+		cf, err := NewControlFileDecoder(bytes.NewReader(data)).Decode(size)
+		if err != nil {
+			return
+		}
+
+		encoded, err := cf.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := NewControlFileDecoder(bytes.NewReader(encoded)).Decode(len(encoded))
+		if err != nil {
+			t.Fatalf("encoded control file %q is not decoded: %v", encoded, err)
+		}
+		if len(decoded) != len(cf) {
+			t.Fatalf("expected %v, got %v", cf, decoded)
+		}
+		for cmd, value := range cf {
+			if decoded[cmd] != value {
+				t.Fatalf("expected %q for %q, got %q", value, cmd, decoded[cmd])
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package lpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory is a backend which stores the data files of every job in a directory. The metadata of the job
+// is written to a json file next to the data files, it is created last, so a job is complete once it exists.
+type Directory struct {
+	Path string
+	// FileMode of the created files, defaults to 0644
+	FileMode os.FileMode
+}
+
+// JobMetadata is the content of the json file written by the Directory backend
+type JobMetadata struct {
+	Queue           string            `json:"queue"`
+	Number          int               `json:"number"`
+	ControlFileName string            `json:"controlFileName"`
+	ControlFile     map[string]string `json:"controlFile"`
+	PrintLines      []PrintLineInfo   `json:"printLines"`
+	DataFiles       []DataFileInfo    `json:"dataFiles"`
+	RemoteAddr      string            `json:"remoteAddr"`
+	Received        time.Time         `json:"received"`
+}
+
+type PrintLineInfo struct {
+	Format string `json:"format"`
+	File   string `json:"file"`
+}
+
+type DataFileInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Path is the file name of the stored data file, relative to the directory
+	Path string `json:"path"`
+}
+
+func (d *Directory) Deliver(job *Job) error {
+	if err := os.MkdirAll(d.Path, 0755); err != nil {
+		return err
+	}
+
+	prefix := d.prefix(job)
+	meta := JobMetadata{
+		Queue:           job.Queue,
+		Number:          job.Number,
+		ControlFileName: job.ControlFileName,
+		ControlFile:     make(map[string]string),
+		RemoteAddr:      job.RemoteAddr,
+		Received:        job.Received,
+	}
+
+	for cmd, value := range job.ControlFile {
+		meta.ControlFile[string(cmd)] = value
+	}
+	for _, line := range job.PrintLines() {
+		meta.PrintLines = append(meta.PrintLines, PrintLineInfo{Format: string(line.Format), File: line.File})
+	}
+
+	for _, df := range job.DataFiles {
+		name := prefix + "." + safeFileName(df.Name)
+		if err := d.storeDataFile(df, filepath.Join(d.Path, name)); err != nil {
+			return err
+		}
+		meta.DataFiles = append(meta.DataFiles, DataFileInfo{Name: df.Name, Size: df.Size, Path: name})
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary name first, so readers never see partial metadata
+	metaPath := filepath.Join(d.Path, prefix+".json")
+	if err := writeFile(metaPath+".tmp", data, d.fileMode()); err != nil {
+		return err
+	}
+
+	return os.Rename(metaPath+".tmp", metaPath)
+}
+
+func (d *Directory) storeDataFile(df *DataFile, path string) error {
+	src, err := df.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, d.fileMode())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+func (d *Directory) fileMode() os.FileMode {
+	if d.FileMode != 0 {
+		return d.FileMode
+	}
+
+	return 0644
+}
+
+// prefix returns a unique name for the files of a job
+func (d *Directory) prefix(job *Job) string {
+	name := job.ControlFileName
+	if name == "" {
+		name = fmt.Sprintf("cfA%03d", job.Number)
+	}
+
+	return fmt.Sprintf("%s-%s-%s", job.Received.Format("20060102T150405.000000000"), safeFileName(job.Queue), safeFileName(name))
+}
+
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// safeFileName replaces all characters of a client supplied name which could escape the directory
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+}
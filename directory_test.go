@@ -0,0 +1,71 @@
+package lpd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestJob(t *testing.T, data string) *Job {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "dfA007host")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	return &Job{
+		Number:          7,
+		Queue:           "lp",
+		ControlFileName: "cfA007host",
+		ControlFile:     ControlFile{Hostname: "host", UserID: "alice", JobName: "report"},
+		RawControlFile:  []byte("Hhost\nPalice\nJreport\nfdfA007host\n"),
+		DataFiles:       []*DataFile{{Name: "dfA007host", Size: int64(len(data)), Path: path}},
+		Received:        time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestDirectoryDeliver(t *testing.T) {
+	dir := t.TempDir()
+	job := newTestJob(t, "hello world")
+
+	backend := &Directory{Path: dir}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while delivering job: %v", err)
+	}
+
+	metaFiles, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(metaFiles) != 1 {
+		t.Fatalf("expected one metadata file, got %v", metaFiles)
+	}
+
+	data, err := ioutil.ReadFile(metaFiles[0])
+	if err != nil {
+		t.Fatalf("could not read metadata file: %v", err)
+	}
+
+	var meta JobMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("could not decode metadata: %v", err)
+	}
+
+	if meta.Queue != "lp" || meta.Number != 7 || meta.ControlFile["P"] != "alice" {
+		t.Errorf("metadata is not correct, got %+v", meta)
+	}
+	if len(meta.PrintLines) != 1 || meta.PrintLines[0].Format != "f" {
+		t.Errorf("print lines are not correct, got %+v", meta.PrintLines)
+	}
+	if len(meta.DataFiles) != 1 {
+		t.Fatalf("expected one data file, got %+v", meta.DataFiles)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, meta.DataFiles[0].Path))
+	if err != nil {
+		t.Fatalf("could not read stored data file: %v", err)
+	}
+	if string(content) != "hello world" {
+		t.Errorf("stored data file is not correct, expected %q, got %q", "hello world", content)
+	}
+}
@@ -0,0 +1,188 @@
+package lpd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultWidth is the width of the output if the control file contains no 'W' command
+const DefaultWidth = 132
+
+// FilterOptions are passed to a filter for every print line it converts
+type FilterOptions struct {
+	// Width is taken from the 'W' command, defaults to DefaultWidth
+	Width int
+	// Indent is taken from the 'I' command
+	Indent int
+	// Title is taken from the 'T' command
+	Title string
+	Job   *Job
+	Line  PrintLine
+}
+
+func newFilterOptions(job *Job, line PrintLine) FilterOptions {
+	opts := controlFileOptions(job.ControlFile)
+	opts.Job = job
+	opts.Line = line
+
+	return opts
+}
+
+// controlFileOptions takes the width, indent and title from the control file
+func controlFileOptions(cf ControlFile) FilterOptions {
+	opts := FilterOptions{
+		Width: DefaultWidth,
+		Title: cf[Title],
+	}
+
+	if width, err := strconv.Atoi(cf[WidthOfOutput]); err == nil && width > 0 {
+		opts.Width = width
+	}
+	if indent, err := strconv.Atoi(cf[Indent]); err == nil && indent > 0 {
+		opts.Indent = indent
+	}
+
+	return opts
+}
+
+// Filter converts a data file before it is delivered to the backend of a queue. Like the filters of the bsd lpd,
+// the output is ready for the printer, so the filtered file is printed with the 'l' command.
+type Filter interface {
+	Filter(w io.Writer, r io.Reader, opts FilterOptions) error
+}
+
+type FilterFunc func(w io.Writer, r io.Reader, opts FilterOptions) error
+
+func (f FilterFunc) Filter(w io.Writer, r io.Reader, opts FilterOptions) error {
+	return f(w, r, opts)
+}
+
+// CommandFilter pipes the data file through an external command. The job attributes are passed as environment
+// variables like for the Command backend, LPD_WIDTH and LPD_INDENT are always set.
+type CommandFilter struct {
+	Path string
+	Args []string
+	Env  []string
+}
+
+func (c *CommandFilter) Filter(w io.Writer, r io.Reader, opts FilterOptions) error {
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	cmd.Env = append(os.Environ(), JobEnv(opts.Job, opts.Line)...)
+	cmd.Env = append(cmd.Env, "LPD_WIDTH="+strconv.Itoa(opts.Width), "LPD_INDENT="+strconv.Itoa(opts.Indent))
+	cmd.Env = append(cmd.Env, c.Env...)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("filter %s failed: %v: %s", c.Path, err, msg)
+		}
+		return fmt.Errorf("filter %s failed: %v", c.Path, err)
+	}
+
+	return nil
+}
+
+// filterJob returns a copy of the job with all print lines converted which have a filter for their format.
+// The filtered files are returned separately, they have to be removed after the delivery.
+func filterJob(job *Job, filters map[OutputFormat]Filter) (*Job, []*DataFile, error) {
+	filtered := *job
+	filtered.DataFiles = append([]*DataFile(nil), job.DataFiles...)
+
+	var created []*DataFile
+	var controlFile []byte
+
+	for _, line := range bytes.SplitAfter(job.RawControlFile, []byte(LineEnding)) {
+		trimmed := bytes.TrimSuffix(line, []byte(LineEnding))
+		if len(trimmed) < 2 || !ControlFileCommand(trimmed[0]).IsOutputFormat() {
+			controlFile = append(controlFile, line...)
+			continue
+		}
+
+		printLine := PrintLine{Format: OutputFormat(trimmed[0]), File: string(trimmed[1:])}
+		filter, ok := filters[printLine.Format]
+		df := job.DataFile(printLine.File)
+		if !ok || df == nil {
+			controlFile = append(controlFile, line...)
+			continue
+		}
+
+		name := fmt.Sprintf("%s.%c", printLine.File, printLine.Format)
+		if filtered.DataFile(name) == nil {
+			out, err := runFilter(filter, df, newFilterOptions(job, printLine))
+			if err != nil {
+				removeDataFiles(created)
+				return nil, nil, err
+			}
+
+			out.Name = name
+			created = append(created, out)
+			filtered.DataFiles = append(filtered.DataFiles, out)
+		}
+
+		controlFile = append(controlFile, byte(PrintWithLeavingControlCharacters))
+		controlFile = append(controlFile, name...)
+		controlFile = append(controlFile, LineEnding...)
+	}
+
+	if len(created) == 0 {
+		return job, nil, nil
+	}
+
+	cf, err := NewControlFileDecoder(bytes.NewReader(controlFile)).Decode(len(controlFile))
+	if err != nil {
+		removeDataFiles(created)
+		return nil, nil, err
+	}
+
+	filtered.RawControlFile = controlFile
+	filtered.ControlFile = cf
+
+	return &filtered, created, nil
+}
+
+func runFilter(filter Filter, df *DataFile, opts FilterOptions) (*DataFile, error) {
+	in, err := df.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(df.Path), "lpd-filtered")
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	result := &DataFile{Path: out.Name()}
+
+	if err := filter.Filter(out, in, opts); err != nil {
+		os.Remove(result.Path)
+		return nil, err
+	}
+
+	stat, err := out.Stat()
+	if err != nil {
+		os.Remove(result.Path)
+		return nil, err
+	}
+	result.Size = stat.Size()
+
+	return result, nil
+}
+
+func removeDataFiles(files []*DataFile) {
+	for _, df := range files {
+		os.Remove(df.Path)
+	}
+}
@@ -0,0 +1,88 @@
+package lpd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFilterJob(t *testing.T) {
+	job := newTestJob(t, "hello world")
+	job.ControlFile[WidthOfOutput] = "80"
+	job.ControlFile[Title] = "greeting"
+
+	var opts FilterOptions
+	upper := FilterFunc(func(w io.Writer, r io.Reader, o FilterOptions) error {
+		opts = o
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(data))
+		return err
+	})
+
+	filtered, created, err := filterJob(job, map[OutputFormat]Filter{PlainTextFile: upper})
+	if err != nil {
+		t.Fatalf("error while filtering job: %v", err)
+	}
+	defer removeDataFiles(created)
+
+	if opts.Width != 80 || opts.Indent != 0 || opts.Title != "greeting" {
+		t.Errorf("filter options are not correct, got %+v", opts)
+	}
+
+	lines := filtered.PrintLines()
+	if len(lines) != 1 || lines[0].Format != PrintWithLeavingControlCharacters {
+		t.Fatalf("print lines are not correct, got %v", lines)
+	}
+
+	content, err := ioutil.ReadFile(filtered.DataFile(lines[0].File).Path)
+	if err != nil {
+		t.Fatalf("could not read filtered file: %v", err)
+	}
+	if string(content) != "HELLO WORLD" {
+		t.Errorf("filtered file is not correct, expected %q, got %q", "HELLO WORLD", content)
+	}
+
+	// the original job must not be changed, it is filtered again on the next attempt
+	if lines := job.PrintLines(); lines[0].Format != PlainTextFile {
+		t.Errorf("original job was modified, got %v", lines)
+	}
+}
+
+func TestFilterJobWithoutMatchingFilter(t *testing.T) {
+	job := newTestJob(t, "hello world")
+
+	filtered, created, err := filterJob(job, map[OutputFormat]Filter{DVIFile: &CommandFilter{Path: "/bin/false"}})
+	if err != nil {
+		t.Fatalf("error while filtering job: %v", err)
+	}
+
+	if filtered != job || len(created) != 0 {
+		t.Errorf("job without matching filter was changed")
+	}
+}
+
+func TestCommandFilter(t *testing.T) {
+	job := newTestJob(t, "hello world")
+	job.ControlFile[Indent] = "4"
+
+	filter := &CommandFilter{
+		Path: "/bin/sh",
+		Args: []string{"-c", `echo "$LPD_WIDTH $LPD_INDENT $LPD_USER"; tr a-z A-Z`},
+	}
+
+	out := new(bytes.Buffer)
+	opts := newFilterOptions(job, job.PrintLines()[0])
+	if err := filter.Filter(out, strings.NewReader("hello"), opts); err != nil {
+		t.Fatalf("error while running filter: %v", err)
+	}
+
+	if expected := fmt.Sprintf("%d 4 alice\nHELLO", DefaultWidth); out.String() != expected {
+		t.Errorf("filter output is not correct, expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,101 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// FortranFormatter interprets the first column of every line as FORTRAN carriage control, it implements the 'r'
+// output format:
+//
+//	' ' advance one line
+//	'0' advance two lines
+//	'-' advance three lines
+//	'1' start a new page
+//	'+' no advance, the line overprints the previous one
+//
+// Other characters are handled like a blank. A new page on the first line is ignored, the printer is at the top
+// of a page anyway.
+type FortranFormatter struct{}
+
+func (f *FortranFormatter) Filter(w io.Writer, r io.Reader, opts FilterOptions) error {
+	return f.Format(w, r)
+}
+
+// Document converts a document on the client side, the result is printed with the 'l' command
+func (f *FortranFormatter) Document(doc Document, cf ControlFile) (Document, error) {
+	buf := new(bytes.Buffer)
+	if err := f.Format(buf, doc.Document); err != nil {
+		return Document{}, err
+	}
+
+	return Document{
+		Document: buf,
+		Size:     buf.Len(),
+		Name:     doc.Name,
+	}, nil
+}
+
+func (f *FortranFormatter) Format(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	br := bufio.NewReader(r)
+	first := true
+
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+			control := byte(' ')
+			if len(line) > 0 {
+				control, line = line[0], line[1:]
+			}
+
+			bw.WriteString(carriageControl(control, first))
+			bw.WriteString(line)
+			first = false
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !first {
+		bw.WriteString("\n")
+	}
+
+	return bw.Flush()
+}
+
+// carriageControl returns the characters which end the previous line and move to the next one
+func carriageControl(control byte, first bool) string {
+	if first {
+		switch control {
+		case '0':
+			return "\n"
+		case '-':
+			return "\n\n"
+		default:
+			return ""
+		}
+	}
+
+	switch control {
+	case '0':
+		return "\n\n"
+	case '-':
+		return "\n\n\n"
+	case '1':
+		return "\n\f"
+	case '+':
+		return "\r"
+	default:
+		return "\n"
+	}
+}
@@ -0,0 +1,83 @@
+package lpd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var fortranTestCases = []struct {
+	Deck     string
+	Expected string
+}{
+	{
+		Deck:     " line 1\n line 2\n",
+		Expected: "line 1\nline 2\n",
+	},
+	{
+		Deck:     "1REPORT\n0TOTAL\n-END\n",
+		Expected: "REPORT\n\nTOTAL\n\n\nEND\n",
+	},
+	{
+		Deck:     " PAGE 1\n1PAGE 2\r\n",
+		Expected: "PAGE 1\n\fPAGE 2\n",
+	},
+	{
+		Deck:     " BOLD\n+____\n",
+		Expected: "BOLD\r____\n",
+	},
+	{
+		// empty lines and unknown control characters advance one line
+		Deck:     " A\n\nXB",
+		Expected: "A\n\nB\n",
+	},
+	{
+		Deck:     "0FIRST\n",
+		Expected: "\nFIRST\n",
+	},
+	{
+		Deck:     "",
+		Expected: "",
+	},
+}
+
+func TestFortranFormatter(t *testing.T) {
+	f := &FortranFormatter{}
+
+	for _, c := range fortranTestCases {
+		out := new(bytes.Buffer)
+		if err := f.Format(out, strings.NewReader(c.Deck)); err != nil {
+			t.Errorf("error while converting deck %q: %v", c.Deck, err)
+		}
+
+		if out.String() != c.Expected {
+			t.Errorf("conversion of deck %q is not correct, expected %q, got %q", c.Deck, c.Expected, out.String())
+		}
+	}
+}
+
+func TestPrintPreprocessed(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	deck := "1REPORT\n TOTAL 42\n"
+	err := client.PrintPreprocessed(Document{
+		Document: strings.NewReader(deck),
+		Size:     len(deck),
+		Name:     "report.txt",
+	}, "lp", nil, &FortranFormatter{})
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	received := backend.next(t)
+
+	if expected := "REPORT\nTOTAL 42\n"; string(received.Data) != expected {
+		t.Errorf("data file is not correct, expected %q, got %q", expected, received.Data)
+	}
+
+	lines := received.Job.PrintLines()
+	if len(lines) != 1 || lines[0].Format != PrintWithLeavingControlCharacters {
+		t.Errorf("print lines are not correct, got %v", lines)
+	}
+}
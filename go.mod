@@ -1,3 +1,3 @@
 module github.com/phin1x/go-lpd
 
-go 1.12
+go 1.18
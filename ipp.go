@@ -0,0 +1,285 @@
+package lpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/user"
+	"sync/atomic"
+)
+
+// the ipp encoding is described in https://tools.ietf.org/html/rfc8010
+
+const (
+	ippOperationPrintJob uint16 = 0x0002
+
+	ippTagOperation       byte   = 0x01
+	ippTagJob             byte   = 0x02
+	ippTagEnd             byte   = 0x03
+	ippTagInteger         byte   = 0x21
+	ippTagName            byte   = 0x42
+	ippTagURI             byte   = 0x45
+	ippTagCharset         byte   = 0x47
+	ippTagNaturalLang     byte   = 0x48
+	ippTagMimeMediaType   byte   = 0x49
+	ippStatusSuccessMax   uint16 = 0x00ff
+	ippContentType               = "application/ipp"
+	ippDefaultPort               = "631"
+	defaultDocumentFormat        = "application/octet-stream"
+)
+
+// DocumentFormats maps the output formats to the ipp document format, unlisted formats are sent as application/octet-stream
+var DocumentFormats = map[OutputFormat]string{
+	PlainTextFile:                     "text/plain",
+	PrintWithLeavingControlCharacters: "text/plain",
+	PRFormat:                          "text/plain",
+	PostscriptFile:                    "application/postscript",
+	DVIFile:                           "application/x-dvi",
+	TroffFormat:                       "application/x-troff",
+	DitroffFile:                       "application/x-troff",
+	RasterFormat:                      "image/x-sun-raster",
+}
+
+var ippRequestID int32
+
+// IPP is a backend which sends every data file of a job as a Print-Job request to an ipp printer.
+// Repeated print lines of the same data file are sent as copies, a retry only sends the data files which were not
+// accepted yet.
+type IPP struct {
+	// URI of the printer, e.g. ipp://printer/ipp/print, http and https uris are accepted too
+	URI string
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (i *IPP) Deliver(job *Job) error {
+	var files []string
+	copies := make(map[string]int)
+	formats := make(map[string]OutputFormat)
+
+	for _, line := range job.PrintLines() {
+		if copies[line.File] == 0 {
+			files = append(files, line.File)
+			formats[line.File] = line.Format
+		}
+		copies[line.File]++
+	}
+
+	for n, name := range files {
+		df := job.DataFile(name)
+		if df == nil || job.isDelivered(n) {
+			continue
+		}
+
+		if err := i.printJob(job, df, formats[name], copies[name]); err != nil {
+			return err
+		}
+		job.setDelivered(n)
+	}
+
+	return nil
+}
+
+func (i *IPP) printJob(job *Job, df *DataFile, of OutputFormat, copies int) error {
+	httpURL, err := ippHTTPURL(i.URI)
+	if err != nil {
+		return err
+	}
+
+	f, err := df.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format, ok := DocumentFormats[of]
+	if !ok {
+		format = defaultDocumentFormat
+	}
+
+	username := job.ControlFile[UserID]
+	if username == "" {
+		if currentUser, err := user.Current(); err == nil {
+			username = currentUser.Username
+		}
+	}
+
+	jobName := job.ControlFile[JobName]
+	if jobName == "" {
+		jobName = dataFileTitle(job, df)
+	}
+
+	buf := new(bytes.Buffer)
+	enc := &ippEncoder{w: buf}
+	enc.header(ippOperationPrintJob, atomic.AddInt32(&ippRequestID, 1))
+	enc.tag(ippTagOperation)
+	enc.attribute(ippTagCharset, "attributes-charset", []byte("utf-8"))
+	enc.attribute(ippTagNaturalLang, "attributes-natural-language", []byte("en"))
+	enc.attribute(ippTagURI, "printer-uri", []byte(i.URI))
+	enc.attribute(ippTagName, "requesting-user-name", []byte(username))
+	enc.attribute(ippTagName, "job-name", []byte(jobName))
+	enc.attribute(ippTagMimeMediaType, "document-format", []byte(format))
+	enc.tag(ippTagJob)
+	enc.attribute(ippTagInteger, "copies", ippInteger(int32(copies)))
+	enc.tag(ippTagEnd)
+	if enc.err != nil {
+		return enc.err
+	}
+
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(httpURL, ippContentType, io.MultiReader(buf, f))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ipp printer responded with http status %s", resp.Status)
+	}
+
+	status, _, attributes, err := decodeIPPMessage(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if status > ippStatusSuccessMax {
+		if message, ok := attributes["status-message"]; ok {
+			return fmt.Errorf("ipp printer rejected the job with status %#04x: %s", status, message)
+		}
+		return fmt.Errorf("ipp printer rejected the job with status %#04x", status)
+	}
+
+	return nil
+}
+
+// ippHTTPURL converts ipp and ipps uris to the http url which is used to send the request
+func ippHTTPURL(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "ipp", "ipps":
+		if u.Port() == "" {
+			u.Host += ":" + ippDefaultPort
+		}
+		if u.Scheme == "ipp" {
+			u.Scheme = "http"
+		} else {
+			u.Scheme = "https"
+		}
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported ipp uri scheme %q", u.Scheme)
+	}
+
+	return u.String(), nil
+}
+
+func ippInteger(i int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(i))
+	return b
+}
+
+// ippEncoder writes ipp messages, the first error is kept and stops all further writes
+type ippEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *ippEncoder) write(data interface{}) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, data)
+	}
+}
+
+func (e *ippEncoder) header(operation uint16, requestID int32) {
+	// version 1.1
+	e.write([]byte{1, 1})
+	e.write(operation)
+	e.write(requestID)
+}
+
+func (e *ippEncoder) tag(tag byte) {
+	e.write(tag)
+}
+
+func (e *ippEncoder) attribute(tag byte, name string, value []byte) {
+	e.write(tag)
+	e.write(int16(len(name)))
+	e.write([]byte(name))
+	e.write(int16(len(value)))
+	e.write(value)
+}
+
+// decodeIPPMessage reads an ipp message up to the end of attributes tag, the values of additional attributes
+// with the same name are dropped. The status is the operation id for requests.
+func decodeIPPMessage(r io.Reader) (status uint16, requestID int32, attributes map[string]string, err error) {
+	var header struct {
+		Version   [2]byte
+		Status    uint16
+		RequestID int32
+	}
+	if err = binary.Read(r, binary.BigEndian, &header); err != nil {
+		return
+	}
+
+	attributes = make(map[string]string)
+
+	for {
+		var tag byte
+		if err = binary.Read(r, binary.BigEndian, &tag); err != nil {
+			return
+		}
+
+		if tag == ippTagEnd {
+			return header.Status, header.RequestID, attributes, nil
+		}
+		if tag < 0x10 {
+			// delimiter tag of an attribute group
+			continue
+		}
+
+		var name, value []byte
+		if name, err = readIPPField(r); err != nil {
+			return
+		}
+		if value, err = readIPPField(r); err != nil {
+			return
+		}
+
+		if len(name) == 0 {
+			// additional value of the previous attribute
+			continue
+		}
+		if tag == ippTagInteger && len(value) == 4 {
+			attributes[string(name)] = fmt.Sprint(int32(binary.BigEndian.Uint32(value)))
+		} else {
+			attributes[string(name)] = string(value)
+		}
+	}
+}
+
+func readIPPField(r io.Reader) ([]byte, error) {
+	var length int16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, errors.New("invalid ipp field length")
+	}
+
+	field := make([]byte, length)
+	_, err := io.ReadFull(r, field)
+	return field, err
+}
@@ -0,0 +1,182 @@
+package lpd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+type ippRequest struct {
+	Operation  uint16
+	Attributes map[string]string
+	Document   []byte
+}
+
+func startIPPStandIn(t *testing.T, status uint16) (*httptest.Server, chan ippRequest) {
+	requests := make(chan ippRequest, 10)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != ippContentType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		operation, requestID, attributes, err := decodeIPPMessage(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		document, _ := ioutil.ReadAll(r.Body)
+
+		requests <- ippRequest{Operation: operation, Attributes: attributes, Document: document}
+
+		w.Header().Set("Content-Type", ippContentType)
+		enc := &ippEncoder{w: w}
+		enc.header(status, requestID)
+		enc.tag(ippTagOperation)
+		enc.attribute(ippTagCharset, "attributes-charset", []byte("utf-8"))
+		enc.attribute(ippTagNaturalLang, "attributes-natural-language", []byte("en"))
+		enc.tag(ippTagEnd)
+	}))
+	t.Cleanup(s.Close)
+
+	return s, requests
+}
+
+func TestIPPDeliver(t *testing.T) {
+	s, requests := startIPPStandIn(t, 0)
+
+	path := filepath.Join(t.TempDir(), "dfA001host")
+	if err := ioutil.WriteFile(path, []byte("%!PS"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	job := &Job{
+		ControlFile:    ControlFile{UserID: "alice", JobName: "report"},
+		RawControlFile: []byte("Palice\nJreport\nodfA001host\nodfA001host\n"),
+		DataFiles:      []*DataFile{{Name: "dfA001host", Size: 4, Path: path}},
+	}
+
+	backend := &IPP{URI: s.URL + "/ipp/print"}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while delivering job: %v", err)
+	}
+
+	request := <-requests
+
+	if request.Operation != ippOperationPrintJob {
+		t.Errorf("operation is not correct, expected %#04x, got %#04x", ippOperationPrintJob, request.Operation)
+	}
+
+	expected := map[string]string{
+		"printer-uri":          s.URL + "/ipp/print",
+		"requesting-user-name": "alice",
+		"job-name":             "report",
+		"document-format":      "application/postscript",
+		"copies":               "2",
+	}
+	for name, value := range expected {
+		if request.Attributes[name] != value {
+			t.Errorf("attribute %s is not correct, expected %q, got %q", name, value, request.Attributes[name])
+		}
+	}
+
+	if !bytes.Equal(request.Document, []byte("%!PS")) {
+		t.Errorf("document is not correct, expected %q, got %q", "%!PS", request.Document)
+	}
+}
+
+func TestIPPDeliverRejected(t *testing.T) {
+	// server-error-not-accepting-jobs
+	s, _ := startIPPStandIn(t, 0x0506)
+
+	path := filepath.Join(t.TempDir(), "dfA001host")
+	if err := ioutil.WriteFile(path, []byte("text"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	job := &Job{
+		ControlFile:    ControlFile{},
+		RawControlFile: []byte("fdfA001host\n"),
+		DataFiles:      []*DataFile{{Name: "dfA001host", Size: 4, Path: path}},
+	}
+
+	backend := &IPP{URI: s.URL}
+	if err := backend.Deliver(job); err == nil {
+		t.Error("expected an error for a rejected job")
+	}
+}
+
+func TestIPPDeliverRetry(t *testing.T) {
+	s, requests := startIPPStandIn(t, 0)
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "dfA001host"), filepath.Join(dir, "dfB001host")
+	if err := ioutil.WriteFile(first, []byte("first"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	// the second data file is missing, so the first attempt fails after the first data file
+	job := &Job{
+		ControlFile:    ControlFile{UserID: "alice"},
+		RawControlFile: []byte("fdfA001host\nfdfB001host\n"),
+		DataFiles:      []*DataFile{{Name: "dfA001host", Size: 5, Path: first}, {Name: "dfB001host", Size: 6, Path: second}},
+	}
+
+	backend := &IPP{URI: s.URL}
+	if err := backend.Deliver(job); err == nil {
+		t.Fatal("expected an error for the missing data file")
+	}
+
+	if err := ioutil.WriteFile(second, []byte("second"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+	if err := backend.Deliver(job); err != nil {
+		t.Fatalf("error while retrying job: %v", err)
+	}
+
+	// the first data file is sent only once
+	close(requests)
+	var documents []string
+	for request := range requests {
+		documents = append(documents, string(request.Document))
+	}
+	if len(documents) != 2 || documents[0] != "first" || documents[1] != "second" {
+		t.Errorf("documents are not correct, got %q", documents)
+	}
+}
+
+func TestIPPDeliverStatusHighBit(t *testing.T) {
+	// status codes with the high bit set must not be taken for success
+	s, _ := startIPPStandIn(t, 0x8001)
+
+	job := newTestJob(t, "text")
+	if err := (&IPP{URI: s.URL}).Deliver(job); err == nil {
+		t.Error("expected an error for status 0x8001")
+	}
+}
+
+func TestIPPHTTPURL(t *testing.T) {
+	testCases := map[string]string{
+		"ipp://printer/ipp/print":       "http://printer:631/ipp/print",
+		"ipps://printer:443/ipp/print":  "https://printer:443/ipp/print",
+		"http://printer:8631/ipp/print": "http://printer:8631/ipp/print",
+	}
+
+	for uri, expected := range testCases {
+		result, err := ippHTTPURL(uri)
+		if err != nil {
+			t.Errorf("error while converting uri %s: %v", uri, err)
+		}
+		if result != expected {
+			t.Errorf("url is not correct, expected %s, got %s", expected, result)
+		}
+	}
+
+	if _, err := ippHTTPURL("lpd://printer/queue"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
@@ -0,0 +1,184 @@
+package lpd
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job is a print job received by the server
+type Job struct {
+	// Number is the three digit job number taken from the control file name
+	Number          int
+	Queue           string
+	ControlFileName string
+	ControlFile     ControlFile
+	// RawControlFile holds the control file as it was received, unlike ControlFile it keeps repeated lines
+	RawControlFile []byte
+	DataFiles      []*DataFile
+	RemoteAddr     string
+	Received       time.Time
+
+	// held jobs are skipped by the queue until they are released
+	held bool
+	// delivered holds the parts of the job a backend delivered already, a retry skips them. The map is shared with
+	// the copies the filters and the banner make of the job.
+	delivered map[int]bool
+	// spooled is the size of the data files counted in the spool size of the server, release frees it
+	spooled int64
+	release func(int64)
+	// quota holds the usage reserved for the job until it is counted or removed
+	quota    *Quota
+	reserved QuotaUsage
+	// spoolFile is the job file in the spool directory, it is empty if the job is not kept across restarts
+	spoolFile string
+}
+
+// DataFile is a data file of a job, stored in the spool directory of the server
+type DataFile struct {
+	Name string
+	Size int64
+	Path string
+}
+
+func (d *DataFile) Open() (*os.File, error) {
+	return os.Open(d.Path)
+}
+
+// PrintLine is a control file line which causes a data file to be printed
+type PrintLine struct {
+	Format OutputFormat
+	File   string
+}
+
+// PrintLines returns all print lines of the control file in order, a repeated line means another copy
+func (j *Job) PrintLines() []PrintLine {
+	var lines []PrintLine
+
+	for _, line := range bytes.Split(j.RawControlFile, []byte(LineEnding)) {
+		if len(line) > 1 && ControlFileCommand(line[0]).IsOutputFormat() {
+			lines = append(lines, PrintLine{
+				Format: OutputFormat(line[0]),
+				File:   string(line[1:]),
+			})
+		}
+	}
+
+	return lines
+}
+
+// DataFile returns the data file with the given name or nil if the job has no such file
+func (j *Job) DataFile(name string) *DataFile {
+	for _, df := range j.DataFiles {
+		if df.Name == name {
+			return df
+		}
+	}
+
+	return nil
+}
+
+// Size returns the total size of all data files
+func (j *Job) Size() int64 {
+	var size int64
+	for _, df := range j.DataFiles {
+		size += df.Size
+	}
+
+	return size
+}
+
+// Remove deletes the job file and the spooled data files of the job and releases its quota reservation
+func (j *Job) Remove() error {
+	if j.release != nil && j.spooled > 0 {
+		j.release(j.spooled)
+		j.spooled = 0
+	}
+	if j.quota != nil {
+		j.quota.release(j)
+	}
+
+	var err error
+	// the job file goes first, so a crash does not leave a job without its data files
+	if j.spoolFile != "" {
+		if inErr := os.Remove(j.spoolFile); inErr != nil && !os.IsNotExist(inErr) {
+			err = inErr
+		}
+		j.spoolFile = ""
+	}
+	for _, df := range j.DataFiles {
+		if inErr := os.Remove(df.Path); inErr != nil && !os.IsNotExist(inErr) {
+			err = inErr
+		}
+	}
+
+	return err
+}
+
+// isDelivered reports whether part i of the job, e.g. its i-th print line, was delivered by an earlier attempt
+func (j *Job) isDelivered(i int) bool {
+	return j.delivered[i]
+}
+
+// setDelivered records that part i of the job was delivered
+func (j *Job) setDelivered(i int) {
+	if j.delivered == nil {
+		j.delivered = make(map[int]bool)
+	}
+	j.delivered[i] = true
+}
+
+// complete reports whether all data files referenced by the control file were received
+func (j *Job) complete() bool {
+	if j.RawControlFile == nil {
+		return false
+	}
+
+	lines := j.PrintLines()
+	if len(lines) == 0 {
+		return false
+	}
+
+	for _, line := range lines {
+		if j.DataFile(line.File) == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches reports whether the job is selected by a list of user names and job numbers
+func (j *Job) matches(list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, item := range list {
+		if number, err := strconv.Atoi(item); err == nil {
+			if number == j.Number {
+				return true
+			}
+		} else if item == j.ControlFile[UserID] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJobNumber extracts the job number from a control file name like cfA123hostname
+func parseJobNumber(controlFileName string) int {
+	if len(controlFileName) < 6 || !strings.HasPrefix(controlFileName, "cf") {
+		return 0
+	}
+
+	number, err := strconv.Atoi(controlFileName[3:6])
+	if err != nil {
+		return 0
+	}
+
+	return number
+}
@@ -0,0 +1,139 @@
+package lpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxControlFileSize is used if the server has no control file limit, control files are kept in memory
+const DefaultMaxControlFileSize = 1 << 20
+
+var ErrSpoolFull = errors.New("spool directory is full")
+
+// Limits protect the server against oversized jobs and too many connections. The announced sizes are checked
+// before a file is read. Zero values are unlimited.
+type Limits struct {
+	// MaxControlFileSize defaults to DefaultMaxControlFileSize
+	MaxControlFileSize int64
+	MaxDataFileSize    int64
+	// MaxJobSize limits the total size of the data files of a job
+	MaxJobSize   int64
+	MaxDataFiles int
+	// MaxSpoolSize limits the size of all data files stored by the server
+	MaxSpoolSize int64
+	// MaxConns limits the number of concurrent connections, further connections are closed after accept
+	MaxConns int
+	// MaxConnsPerIP limits the number of concurrent connections from a single remote address
+	MaxConnsPerIP int
+}
+
+func (l Limits) maxControlFileSize() int64 {
+	if l.MaxControlFileSize > 0 {
+		return l.MaxControlFileSize
+	}
+
+	return DefaultMaxControlFileSize
+}
+
+// checkControlFile checks the announced size of a control file
+func (l Limits) checkControlFile(count int64) error {
+	if count > l.maxControlFileSize() {
+		return fmt.Errorf("control file of %d bytes exceeds the limit of %d bytes", count, l.maxControlFileSize())
+	}
+
+	return nil
+}
+
+// checkDataFile checks the announced size of the next data file of a job
+func (l Limits) checkDataFile(job *Job, count int64) error {
+	if l.MaxDataFiles > 0 && len(job.DataFiles) >= l.MaxDataFiles {
+		return fmt.Errorf("job exceeds the limit of %d data files", l.MaxDataFiles)
+	}
+
+	if max := l.dataFileLimit(job); max >= 0 && count > max {
+		return fmt.Errorf("data file of %d bytes exceeds the limit of %d bytes", count, max)
+	}
+
+	return nil
+}
+
+// dataFileLimit returns how many bytes the next data file of the job may have, -1 means unlimited
+func (l Limits) dataFileLimit(job *Job) int64 {
+	max := int64(-1)
+	if l.MaxDataFileSize > 0 {
+		max = l.MaxDataFileSize
+	}
+
+	if l.MaxJobSize > 0 {
+		left := l.MaxJobSize - job.Size()
+		if left < 0 {
+			left = 0
+		}
+		if max < 0 || left < max {
+			max = left
+		}
+	}
+
+	return max
+}
+
+// checkSpool checks if a data file of the announced size fits into the spool directory
+func (s *Server) checkSpool(count int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spoolFits(count)
+}
+
+// reserveSpool counts n more bytes in the spool directory, it fails if the spool limit would be exceeded
+func (s *Server) reserveSpool(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.spoolFits(n); err != nil {
+		return err
+	}
+	s.spooled += n
+
+	return nil
+}
+
+func (s *Server) spoolFits(n int64) error {
+	if s.Limits.MaxSpoolSize > 0 && s.spooled+n > s.Limits.MaxSpoolSize {
+		return ErrSpoolFull
+	}
+
+	return nil
+}
+
+func (s *Server) releaseSpool(n int64) {
+	s.mu.Lock()
+	s.spooled -= n
+	s.mu.Unlock()
+}
+
+// spoolWriter writes a data file to the spool directory and enforces the limits while it is received
+type spoolWriter struct {
+	w      io.Writer
+	server *Server
+	job    *Job
+	// limit of the file size, -1 means unlimited
+	limit   int64
+	written int64
+}
+
+func (w *spoolWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	if w.limit >= 0 && w.written+n > w.limit {
+		return 0, fmt.Errorf("data file exceeds the limit of %d bytes", w.limit)
+	}
+
+	if err := w.server.reserveSpool(n); err != nil {
+		return 0, err
+	}
+	w.job.spooled += n
+	w.written += n
+
+	return w.w.Write(p)
+}
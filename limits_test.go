@@ -0,0 +1,97 @@
+package lpd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerLimits(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Limits Limits
+		Size   int
+	}{
+		{Name: "control file", Limits: Limits{MaxControlFileSize: 10}, Size: 4},
+		{Name: "data file", Limits: Limits{MaxDataFileSize: 100}, Size: 101},
+		{Name: "job", Limits: Limits{MaxJobSize: 100}, Size: 101},
+		{Name: "spool", Limits: Limits{MaxSpoolSize: 100}, Size: 101},
+	}
+
+	for _, c := range testCases {
+		s, client := startConfiguredTestServer(t, func(s *Server) {
+			s.Limits = c.Limits
+		}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+		err := client.PrintDocument(Document{
+			Document: strings.NewReader(strings.Repeat("x", c.Size)),
+			Size:     c.Size,
+			Name:     "data.txt",
+		}, "lp", nil, PlainTextFile)
+		if err == nil {
+			t.Errorf("%s: job above the limit was accepted", c.Name)
+		}
+
+		// the server releases the spool size after it closed the connection
+		var spooled int64
+		for i := 0; i < 100; i++ {
+			s.mu.Lock()
+			spooled = s.spooled
+			s.mu.Unlock()
+			if spooled == 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if spooled != 0 {
+			t.Errorf("%s: spool size was not released, got %d", c.Name, spooled)
+		}
+	}
+}
+
+// startRawReceiveJob opens a connection and sends the receive job command
+func startRawReceiveJob(t *testing.T, client *Client) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", client.dest)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := SendCommandLine(conn, byte(ReceiveJob), []string{"lp"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("receive job command was not acknowledged: %v", err)
+	}
+
+	return conn
+}
+
+func TestServerLimitsDataFiles(t *testing.T) {
+	_, client := startConfiguredTestServer(t, func(s *Server) {
+		s.Limits = Limits{MaxDataFiles: 1}
+	}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn := startRawReceiveJob(t, client)
+
+	if err := SendCommandLine(conn, byte(SendDataFile), []string{"4", "dfA001host"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("first data file command was not acknowledged: %v", err)
+	}
+	conn.Write([]byte("data\x00"))
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("first data file was not acknowledged: %v", err)
+	}
+
+	if err := SendCommandLine(conn, byte(SendDataFile), []string{"4", "dfB001host"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err == nil {
+		t.Error("data file above the limit was acknowledged")
+	}
+}
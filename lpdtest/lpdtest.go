@@ -0,0 +1,417 @@
+// Package lpdtest provides a fake lpd server for tests, similar to net/http/httptest.
+//
+// The server listens on a loopback port, accepts every queue and records the command lines, control files and data
+// files it receives. The answers are scripted per phase of the protocol, a phase can be rejected with a negative
+// acknowledgement, delayed or answered by dropping the connection:
+//
+//	srv := lpdtest.NewServer()
+//	defer srv.Close()
+//
+//	srv.NAK(lpdtest.PhaseDataFile)
+//	err := srv.Client().PrintFile("report.txt", "lp", nil)
+package lpdtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phin1x/go-lpd"
+)
+
+// MaxFileSize is the largest control or data file the server accepts, a larger count is answered with a negative
+// acknowledgement
+const MaxFileSize = 16 << 20
+
+// Phase is a step of the protocol which is answered by the server
+type Phase int
+
+const (
+	// PhaseCommand is the answer to the daemon command, which starts a connection
+	PhaseCommand Phase = iota
+	// PhaseControlFileCommand is the answer to the sub command announcing a control file
+	PhaseControlFileCommand
+	// PhaseControlFile is the answer after a control file was received
+	PhaseControlFile
+	// PhaseDataFileCommand is the answer to the sub command announcing a data file
+	PhaseDataFileCommand
+	// PhaseDataFile is the answer after a data file was received
+	PhaseDataFile
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseCommand:
+		return "command"
+	case PhaseControlFileCommand:
+		return "control file command"
+	case PhaseControlFile:
+		return "control file"
+	case PhaseDataFileCommand:
+		return "data file command"
+	case PhaseDataFile:
+		return "data file"
+	}
+
+	return "phase " + strconv.Itoa(int(p))
+}
+
+// Command is a command line received by the server
+type Command struct {
+	// Conn numbers the connections in the order they were accepted, starting with 1
+	Conn int
+	// Daemon is set for the first command line of a connection, Sub for the lines following a receive job command
+	Daemon *lpd.DaemonCommandLine
+	Sub    *lpd.SubCommandLine
+}
+
+// File is a control or data file received by the server
+type File struct {
+	Conn int
+	Name string
+	Data []byte
+	// ControlFile is the decoded content of a control file
+	ControlFile lpd.ControlFile
+}
+
+// answer is the scripted answer of a phase
+type answer struct {
+	nak   bool
+	drop  bool
+	delay time.Duration
+}
+
+// Server is a fake lpd server listening on a loopback port
+type Server struct {
+	// Addr is the address of the server as host:port
+	Addr     string
+	Listener net.Listener
+
+	wg     sync.WaitGroup
+	closed chan struct{}
+
+	mu           sync.Mutex
+	conns        map[net.Conn]struct{}
+	accepted     int
+	answers      map[Phase]answer
+	queueState   string
+	commands     []Command
+	controlFiles []File
+	dataFiles    []File
+}
+
+// NewServer starts a server on a loopback port, it has to be closed by the caller
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("lpdtest: failed to listen on a port: %v", err))
+		}
+	}
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Listener: l,
+		closed:   make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+		answers:  make(map[Phase]answer),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Close stops the server, closes the open connections and waits until they are handled. Close must be called only
+// once.
+func (s *Server) Close() {
+	s.Listener.Close()
+
+	s.mu.Lock()
+	close(s.closed)
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Client returns a client for the server
+func (s *Server) Client() *lpd.Client {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+
+	return lpd.NewClient(host, p)
+}
+
+// NAK answers a phase with a negative acknowledgement, the connection is closed afterwards
+func (s *Server) NAK(p Phase) {
+	s.setAnswer(p, func(a *answer) { a.nak = true })
+}
+
+// Delay waits before a phase is answered
+func (s *Server) Delay(p Phase, d time.Duration) {
+	s.setAnswer(p, func(a *answer) { a.delay = d })
+}
+
+// Drop closes the connection instead of answering a phase
+func (s *Server) Drop(p Phase) {
+	s.setAnswer(p, func(a *answer) { a.drop = true })
+}
+
+// Reset restores the default answers of all phases, the recorded commands and files are kept
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.answers = make(map[Phase]answer)
+}
+
+func (s *Server) setAnswer(p Phase, set func(a *answer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.answers[p]
+	set(&a)
+	s.answers[p] = a
+}
+
+// SetQueueState sets the answer to the queue state commands
+func (s *Server) SetQueueState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queueState = state
+}
+
+// Commands returns the command lines received so far
+func (s *Server) Commands() []Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Command(nil), s.commands...)
+}
+
+// ControlFiles returns the control files received so far
+func (s *Server) ControlFiles() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]File(nil), s.controlFiles...)
+}
+
+// DataFiles returns the data files received so far
+func (s *Server) DataFiles() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]File(nil), s.dataFiles...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.closed:
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.accepted++
+		id := s.accepted
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn, id)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn, id int) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	cmd, err := lpd.ReadDaemonCommand(r)
+	if err != nil {
+		if errors.Is(err, lpd.ErrMalformedCommand) || err == lpd.ErrLineTooLong {
+			conn.Write([]byte{lpd.NegativeAcknowledge})
+		}
+		return
+	}
+	s.record(Command{Conn: id, Daemon: cmd})
+
+	if !s.answer(conn, PhaseCommand) {
+		return
+	}
+
+	switch cmd.Command {
+	case lpd.QueueStatsShort, lpd.QueueStatsLong:
+		s.mu.Lock()
+		state := s.queueState
+		s.mu.Unlock()
+
+		io.WriteString(conn, state)
+	case lpd.ReceiveJob:
+		if _, err := conn.Write([]byte{lpd.Acknowledge}); err != nil {
+			return
+		}
+		s.receiveJob(conn, r, id)
+	default:
+		conn.Write([]byte{lpd.Acknowledge})
+	}
+}
+
+// receiveJob records the sub commands and files until the client closes the connection
+func (s *Server) receiveJob(conn net.Conn, r *bufio.Reader, id int) {
+	for {
+		cmd, err := lpd.ReadSubCommand(r)
+		if err != nil {
+			if errors.Is(err, lpd.ErrMalformedCommand) || err == lpd.ErrLineTooLong {
+				conn.Write([]byte{lpd.NegativeAcknowledge})
+			}
+			return
+		}
+		s.record(Command{Conn: id, Sub: cmd})
+
+		if cmd.Command == lpd.AbortJob {
+			continue
+		}
+
+		commandPhase, filePhase := PhaseControlFileCommand, PhaseControlFile
+		if cmd.Command == lpd.SendDataFile {
+			commandPhase, filePhase = PhaseDataFileCommand, PhaseDataFile
+		}
+
+		if cmd.Count > MaxFileSize {
+			conn.Write([]byte{lpd.NegativeAcknowledge})
+			return
+		}
+		if !s.acknowledge(conn, commandPhase) {
+			return
+		}
+
+		f, err := readFile(r, cmd)
+		if err != nil {
+			return
+		}
+		f.Conn = id
+		s.recordFile(cmd.Command, f)
+
+		if !s.acknowledge(conn, filePhase) {
+			return
+		}
+	}
+}
+
+// readFile reads a control or data file and the zero octet which terminates it
+func readFile(r *bufio.Reader, cmd *lpd.SubCommandLine) (File, error) {
+	f := File{Name: cmd.Name}
+
+	// the buffer grows with the received data, a client which announces more than it sends allocates nothing
+	buf := new(bytes.Buffer)
+	_, err := io.CopyN(buf, r, cmd.Count)
+	f.Data = buf.Bytes()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return f, err
+	}
+
+	end, err := r.ReadByte()
+	if err != nil {
+		return f, err
+	}
+	if end != 0 {
+		return f, fmt.Errorf("file is not terminated by a zero octet, got %#x", end)
+	}
+
+	if cmd.Command == lpd.SendControlFile {
+		cf, err := lpd.NewControlFileDecoder(bytes.NewReader(f.Data)).Decode(len(f.Data))
+		if err != nil {
+			return f, err
+		}
+		f.ControlFile = cf
+	}
+
+	return f, nil
+}
+
+// answer applies the scripted answer of a phase, it reports whether the phase is answered positively
+func (s *Server) answer(conn net.Conn, p Phase) bool {
+	s.mu.Lock()
+	a := s.answers[p]
+	s.mu.Unlock()
+
+	if a.delay > 0 {
+		timer := time.NewTimer(a.delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-s.closed:
+			return false
+		}
+	}
+
+	if a.drop {
+		return false
+	}
+	if a.nak {
+		conn.Write([]byte{lpd.NegativeAcknowledge})
+		return false
+	}
+
+	return true
+}
+
+// acknowledge answers a phase and sends the acknowledgement if the phase is answered positively
+func (s *Server) acknowledge(conn net.Conn, p Phase) bool {
+	if !s.answer(conn, p) {
+		return false
+	}
+
+	_, err := conn.Write([]byte{lpd.Acknowledge})
+	return err == nil
+}
+
+func (s *Server) record(cmd Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, cmd)
+}
+
+func (s *Server) recordFile(cmd lpd.SubCommand, f File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cmd == lpd.SendControlFile {
+		s.controlFiles = append(s.controlFiles, f)
+	} else {
+		s.dataFiles = append(s.dataFiles, f)
+	}
+}
@@ -0,0 +1,140 @@
+package lpdtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phin1x/go-lpd"
+)
+
+func printTestDocument(client *lpd.Client) error {
+	return client.PrintDocument(lpd.Document{
+		Document: strings.NewReader("hello"),
+		Size:     5,
+		Name:     "report",
+	}, "lp", lpd.ControlFile{lpd.UserID: "alice"}, lpd.PlainTextFile)
+}
+
+func TestServerRecords(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	if err := printTestDocument(srv.Client()); err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	commands := srv.Commands()
+	if len(commands) != 3 || commands[0].Daemon == nil || commands[0].Daemon.Command != lpd.ReceiveJob ||
+		commands[1].Sub == nil || commands[1].Sub.Command != lpd.SendControlFile ||
+		commands[2].Sub == nil || commands[2].Sub.Command != lpd.SendDataFile || commands[2].Sub.Count != 5 {
+		t.Fatalf("commands are not recorded correctly, got %+v", commands)
+	}
+
+	controlFiles := srv.ControlFiles()
+	if len(controlFiles) != 1 || controlFiles[0].ControlFile[lpd.UserID] != "alice" || controlFiles[0].Conn != 1 {
+		t.Errorf("control file is not recorded correctly, got %+v", controlFiles)
+	}
+
+	dataFiles := srv.DataFiles()
+	if len(dataFiles) != 1 || string(dataFiles[0].Data) != "hello" || dataFiles[0].Name != commands[2].Sub.Name {
+		t.Errorf("data file is not recorded correctly, got %+v", dataFiles)
+	}
+}
+
+func TestServerScriptedAnswers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	for _, p := range []Phase{PhaseCommand, PhaseControlFileCommand, PhaseControlFile, PhaseDataFileCommand, PhaseDataFile} {
+		srv.NAK(p)
+		if err := printTestDocument(srv.Client()); err == nil {
+			t.Errorf("document was printed with a negative acknowledgement of the %s", p)
+		}
+		srv.Reset()
+
+		srv.Drop(p)
+		if err := printTestDocument(srv.Client()); err == nil {
+			t.Errorf("document was printed with a dropped connection in the %s", p)
+		}
+		srv.Reset()
+	}
+
+	if err := printTestDocument(srv.Client()); err != nil {
+		t.Errorf("error after reset: %v", err)
+	}
+}
+
+func TestServerEmptyFile(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	err := srv.Client().PrintDocument(lpd.Document{Document: strings.NewReader(""), Name: "empty"}, "lp", nil, lpd.PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing an empty document: %v", err)
+	}
+	if dataFiles := srv.DataFiles(); len(dataFiles) != 1 || len(dataFiles[0].Data) != 0 {
+		t.Errorf("empty data file is not recorded correctly, got %+v", dataFiles)
+	}
+}
+
+func TestServerOversizedFile(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	err := srv.Client().PrintDocument(lpd.Document{
+		Document: strings.NewReader("hello"),
+		Size:     MaxFileSize + 1,
+		Name:     "report",
+	}, "lp", lpd.ControlFile{lpd.UserID: "alice"}, lpd.PlainTextFile)
+	if err == nil {
+		t.Error("data file above the maximum size was accepted")
+	}
+	if len(srv.DataFiles()) != 0 {
+		t.Errorf("oversized data file was recorded, got %d files", len(srv.DataFiles()))
+	}
+}
+
+func TestServerDelay(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.Delay(PhaseCommand, 100*time.Millisecond)
+
+	start := time.Now()
+	if err := srv.Client().PrintWaitingJobs("lp"); err != nil {
+		t.Fatalf("error while starting the queue: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("answer was not delayed, took %v", elapsed)
+	}
+
+	// a pending delay does not block close
+	srv.Delay(PhaseCommand, time.Hour)
+	go srv.Client().PrintWaitingJobs("lp")
+	for len(srv.Commands()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServerQueueState(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.SetQueueState("no entries\n")
+
+	state, err := srv.Client().GetQueueStateLong("lp", []string{"7"}, []string{"alice"})
+	if err != nil || state != "no entries\n" {
+		t.Errorf("queue state is not correct, got %q, %v", state, err)
+	}
+
+	if err := srv.Client().RemoveJobs("lp", "root", []string{"7"}, nil); err != nil {
+		t.Fatalf("error while removing jobs: %v", err)
+	}
+
+	commands := srv.Commands()
+	if len(commands) != 2 || commands[0].Daemon.Command != lpd.QueueStatsLong || commands[1].Daemon.Agent != "root" ||
+		strings.Join(commands[1].Daemon.List, " ") != "7" {
+		t.Errorf("commands are not recorded correctly, got %+v", commands)
+	}
+}
@@ -0,0 +1,142 @@
+package lpd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrJobRemoved is the result of jobs which were removed from the queue before they were delivered
+var ErrJobRemoved = errors.New("job was removed")
+
+// Notification is sent for jobs with a mail when printed command ('M') once the queue is done with them
+type Notification struct {
+	// Address is taken from the 'M' command
+	Address string
+	Job     *Job
+	// Err is nil if the job was delivered
+	Err error
+}
+
+// Notifier informs the user about the result of a job, the queue logs the errors
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NotifierFunc is a notifier for in-process integration
+type NotifierFunc func(n Notification) error
+
+func (f NotifierFunc) Notify(n Notification) error {
+	return f(n)
+}
+
+// SMTPNotifier sends the notifications as mails. Addresses without a domain are sent to the host of the job,
+// like the bsd lpd does.
+type SMTPNotifier struct {
+	// Addr of the mail server, format is host:port
+	Addr string
+	From string
+	// Auth is optional
+	Auth smtp.Auth
+	// Timeout limits the whole mail session, defaults to DefaultNotifyTimeout
+	Timeout time.Duration
+}
+
+func (s *SMTPNotifier) Notify(n Notification) error {
+	to := n.Address
+	if !strings.Contains(to, "@") && n.Job.ControlFile[Hostname] != "" {
+		to += "@" + n.Job.ControlFile[Hostname]
+	}
+
+	return s.send(to, s.message(to, n))
+}
+
+// send delivers a mail like smtp.SendMail, but gives up once the timeout expired
+func (s *SMTPNotifier) send(to string, msg []byte) error {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(s.Auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (s *SMTPNotifier) message(to string, n Notification) []byte {
+	name := jobFiles(n.Job)
+
+	subject := fmt.Sprintf("printer job %q completed", name)
+	body := fmt.Sprintf("Your printer job %q (job %03d) on queue %s was printed.\r\n", name, n.Job.Number, n.Job.Queue)
+	if n.Err != nil {
+		subject = fmt.Sprintf("printer job %q failed", name)
+		body = fmt.Sprintf("Your printer job %q (job %03d) on queue %s could not be printed: %v\r\n", name, n.Job.Number, n.Job.Queue, n.Err)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s\r\n", s.From)
+	fmt.Fprintf(buf, "To: %s\r\n", mailHeaderValue(to))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mailHeaderValue(subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(body)
+
+	return buf.Bytes()
+}
+
+// mailHeaderValue removes line breaks, so client supplied values can not add headers
+func mailHeaderValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
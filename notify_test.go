@@ -0,0 +1,200 @@
+package lpd
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// startSMTPStandIn accepts one mail session and sends the received message to the channel
+func startSMTPStandIn(t *testing.T) (string, chan smtpMessage) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan smtpMessage, 1)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost stand-in")
+
+		var msg smtpMessage
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "MAIL":
+				msg.From = line[len("MAIL FROM:"):]
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				msg.To = append(msg.To, line[len("RCPT TO:"):])
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				msg.Data = string(data)
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				messages <- msg
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), messages
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, messages := startSMTPStandIn(t)
+
+	job := newTestJob(t, "data")
+	notifier := &SMTPNotifier{Addr: addr, From: "lpd@printserver"}
+
+	err := notifier.Notify(Notification{Address: "alice", Job: job, Err: errors.New("out of paper")})
+	if err != nil {
+		t.Fatalf("error while sending notification: %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		if msg.From != "<lpd@printserver>" || len(msg.To) != 1 || msg.To[0] != "<alice@host>" {
+			t.Errorf("envelope is not correct, got %+v", msg)
+		}
+		if !strings.Contains(msg.Data, `Subject: printer job "report" failed`) || !strings.Contains(msg.Data, "out of paper") {
+			t.Errorf("message is not correct, got %q", msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// the server accepts the connection, but never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+
+	notifier := &SMTPNotifier{Addr: l.Addr().String(), From: "lpd@printserver", Timeout: 50 * time.Millisecond}
+
+	err = notifier.Notify(Notification{Address: "alice", Job: newTestJob(t, "data")})
+	if err == nil {
+		t.Error("expected an error from a mail server which does not answer")
+	}
+}
+
+// logWriter passes the lines of a logger to a channel
+type logWriter chan string
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestQueueNotifierAsync(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	logs := make(logWriter, 10)
+	notifier := NotifierFunc(func(n Notification) error {
+		if n.Job.ControlFile[JobName] == "blocked" {
+			<-blocked
+		}
+		return errors.New("mail server not available")
+	})
+
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{
+		Name:          "lp",
+		Backend:       backend,
+		Notifier:      notifier,
+		NotifyTimeout: 50 * time.Millisecond,
+		ErrorLog:      log.New(logs, "", 0),
+	})
+
+	// a notification which does not return does not stop the delivery of the next job
+	for _, name := range []string{"blocked", "failing"} {
+		err := client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, "lp", ControlFile{MailWhenPrinted: "alice@example.com", JobName: name}, PlainTextFile)
+		if err != nil {
+			t.Fatalf("error while printing document: %v", err)
+		}
+		backend.next(t)
+	}
+
+	var lines string
+	for i := 0; i < 2; i++ {
+		select {
+		case line := <-logs:
+			lines += line
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification errors are not logged, got %q", lines)
+		}
+	}
+	for _, expected := range []string{"mail server not available", "timed out"} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("expected a log line with %q, got %q", expected, lines)
+		}
+	}
+}
+
+func TestQueueNotifier(t *testing.T) {
+	notifications := make(chan Notification, 1)
+	notifier := NotifierFunc(func(n Notification) error {
+		notifications <- n
+		return nil
+	})
+
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend(), Notifier: notifier})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", ControlFile{MailWhenPrinted: "alice@example.com"}, PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	select {
+	case n := <-notifications:
+		if n.Address != "alice@example.com" || n.Err != nil {
+			t.Errorf("notification is not correct, got %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+}
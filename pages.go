@@ -0,0 +1,317 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+var (
+	pdfPagesType = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfPageType  = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfCount     = regexp.MustCompile(`/Count\s+(\d+)`)
+)
+
+// PageCount is the result of a page counter
+type PageCount struct {
+	Pages int
+	// Exact is set if the page count was read from the document structure, otherwise it is an estimate
+	Exact bool
+}
+
+func (p PageCount) add(other PageCount) PageCount {
+	return PageCount{Pages: p.Pages + other.Pages, Exact: p.Exact && other.Exact}
+}
+
+// PageCounter inspects data files to find out how many pages they print. The document type is detected by the
+// content and falls back to the output format:
+//
+//	PostScript: the DSC comment %%Pages, or the number of %%Page comments
+//	PDF: the /Count of the root page tree, or the number of page objects
+//	PCL: the number of form feeds
+//	text: the number of lines, wrapped at the width, divided by the page length
+type PageCounter struct {
+	// PageLength of text files, defaults to DefaultPageLength
+	PageLength int
+}
+
+// CountJob returns the pages of all print lines of a job, repeated print lines are counted as copies
+func (p *PageCounter) CountJob(job *Job) (PageCount, error) {
+	width := controlFileOptions(job.ControlFile).Width
+	count := PageCount{Exact: true}
+
+	for _, line := range job.PrintLines() {
+		df := job.DataFile(line.File)
+		if df == nil {
+			continue
+		}
+
+		f, err := df.Open()
+		if err != nil {
+			return PageCount{}, err
+		}
+
+		fileCount, err := p.Count(f, line.Format, width)
+		f.Close()
+		if err != nil {
+			return PageCount{}, err
+		}
+
+		count = count.add(fileCount)
+	}
+
+	return count, nil
+}
+
+// Count returns the pages of a data file, the width is used for text files
+func (p *PageCounter) Count(r io.Reader, format OutputFormat, width int) (PageCount, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("%PDF")):
+		return countPDFPages(br)
+	case bytes.HasPrefix(magic, []byte("%!")), format == PostscriptFile:
+		return countPostScriptPages(br)
+	case len(magic) > 0 && magic[0] == 0x1b:
+		return countFormFeedPages(br)
+	}
+
+	switch format {
+	case PlainTextFile, PrintWithLeavingControlCharacters, PRFormat, FortranCarriageControlFormat:
+		pageLength := p.PageLength
+		if pageLength <= 0 {
+			pageLength = DefaultPageLength
+		}
+		if format == PRFormat && pageLength > prHeaderLines+prTrailerLines {
+			pageLength -= prHeaderLines + prTrailerLines
+		}
+
+		return countTextPages(br, width, pageLength)
+	}
+
+	// the format is unknown, every non empty file prints at least one page
+	if len(magic) > 0 {
+		return PageCount{Pages: 1}, nil
+	}
+
+	return PageCount{}, nil
+}
+
+func countPostScriptPages(r *bufio.Reader) (PageCount, error) {
+	pageComments := 0
+	pages := -1
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// skip the rest of a long line, it is no dsc comment
+			for err == bufio.ErrBufferFull {
+				_, err = r.ReadSlice('\n')
+			}
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(line, []byte("%%Pages:")):
+			// the last valid comment wins, a trailer can replace "(atend)" in the header
+			fields := bytes.Fields(line[len("%%Pages:"):])
+			if len(fields) > 0 {
+				if n, convErr := strconv.Atoi(string(fields[0])); convErr == nil {
+					pages = n
+				}
+			}
+		case bytes.HasPrefix(line, []byte("%%Page:")):
+			pageComments++
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return PageCount{}, err
+		}
+	}
+
+	if pages >= 0 {
+		return PageCount{Pages: pages, Exact: true}, nil
+	}
+
+	if pageComments > 0 {
+		return PageCount{Pages: pageComments}, nil
+	}
+
+	return PageCount{Pages: 1}, nil
+}
+
+const (
+	// pdfWindowSize is the size of the blocks a pdf is read in
+	pdfWindowSize = 64 * 1024
+	// pdfWindowOverlap is kept of the previous block, so the dictionary around a match at the end of a block is
+	// still found
+	pdfWindowOverlap = 4 * 1024
+)
+
+// countPDFPages scans the document in overlapping windows, so large files are not loaded into memory
+func countPDFPages(r io.Reader) (PageCount, error) {
+	// the root of the page tree has the highest count
+	pages := -1
+	pageObjects := 0
+
+	buf := make([]byte, pdfWindowSize)
+	var window []byte
+	// matches before scanned were counted in the previous window
+	scanned := 0
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		window = append(window, buf[:n]...)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return PageCount{}, err
+		}
+
+		// matches close to the end are counted in the next window, which has the rest of their dictionary
+		limit := len(window)
+		if !eof {
+			limit -= pdfWindowOverlap
+		}
+		if limit < scanned {
+			limit = scanned
+		}
+
+		for _, loc := range pdfPagesType.FindAllIndex(window, -1) {
+			if loc[0] < scanned || loc[0] >= limit {
+				continue
+			}
+
+			start := bytes.LastIndex(window[:loc[0]], []byte("<<"))
+			end := bytes.Index(window[loc[1]:], []byte(">>"))
+			if start < 0 || end < 0 {
+				continue
+			}
+
+			dict := window[start : loc[1]+end]
+			if match := pdfCount.FindSubmatch(dict); match != nil {
+				if n, err := strconv.Atoi(string(match[1])); err == nil && n > pages {
+					pages = n
+				}
+			}
+		}
+		for _, loc := range pdfPageType.FindAllIndex(window, -1) {
+			if loc[0] >= scanned && loc[0] < limit {
+				pageObjects++
+			}
+		}
+
+		if eof {
+			break
+		}
+
+		// keep the unscanned rest and the overlap before it
+		cut := limit - pdfWindowOverlap
+		if cut < 0 {
+			cut = 0
+		}
+		window = append(window[:0], window[cut:]...)
+		scanned = limit - cut
+	}
+
+	if pages >= 0 {
+		return PageCount{Pages: pages, Exact: true}, nil
+	}
+
+	// the page tree is hidden in a compressed object stream, count the visible page objects
+	if pageObjects > 0 {
+		return PageCount{Pages: pageObjects}, nil
+	}
+
+	return PageCount{Pages: 1}, nil
+}
+
+// countFormFeedPages counts the pages of printer languages like pcl, a page ends with a form feed
+func countFormFeedPages(r io.Reader) (PageCount, error) {
+	buf := make([]byte, 32*1024)
+	pages := 0
+	trailing := false
+
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b == '\f' {
+				pages++
+				trailing = false
+			} else {
+				trailing = true
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return PageCount{}, err
+		}
+	}
+
+	if trailing && pages == 0 {
+		pages = 1
+	}
+
+	return PageCount{Pages: pages}, nil
+}
+
+func countTextPages(r *bufio.Reader, width, pageLength int) (PageCount, error) {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+
+	pages := 0
+	lines := 0
+
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) > 0 {
+			segments := bytes.Split([]byte(line), []byte("\f"))
+			for i, segment := range segments {
+				if i > 0 {
+					// a form feed ends the page
+					pages++
+					lines = 0
+				}
+
+				segment = bytes.TrimRight(segment, "\r\n")
+				if len(segment) == 0 && (i > 0 || len(segments) > 1) {
+					continue
+				}
+
+				lines++
+				if length := utf8.RuneCountInString(expandTabs(string(segment))); length > width {
+					// long lines are wrapped
+					lines += (length - 1) / width
+				}
+
+				for lines > pageLength {
+					pages++
+					lines -= pageLength
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return PageCount{}, err
+		}
+	}
+
+	if lines > 0 {
+		pages++
+	}
+
+	return PageCount{Pages: pages}, nil
+}
@@ -0,0 +1,116 @@
+package lpd
+
+import (
+	"strings"
+	"testing"
+)
+
+var pageCountTestCases = []struct {
+	Name   string
+	Format OutputFormat
+	Width  int
+	Data   string
+	Count  PageCount
+}{
+	{
+		Name:   "postscript with pages comment",
+		Format: PostscriptFile,
+		Data:   "%!PS-Adobe-3.0\n%%Pages: 3\n%%EndComments\n%%Page: 1 1\nshowpage\n%%EOF\n",
+		Count:  PageCount{Pages: 3, Exact: true},
+	},
+	{
+		Name:   "postscript with pages at end",
+		Format: PostscriptFile,
+		Data:   "%!PS-Adobe-3.0\n%%Pages: (atend)\n%%Page: 1 1\n%%Page: 2 2\n%%Trailer\n%%Pages: 2\n%%EOF\n",
+		Count:  PageCount{Pages: 2, Exact: true},
+	},
+	{
+		Name:   "postscript with page comments only",
+		Format: PrintWithLeavingControlCharacters,
+		Data:   "%!PS\n%%Page: 1 1\nshowpage\n%%Page: 2 2\nshowpage\n",
+		Count:  PageCount{Pages: 2},
+	},
+	{
+		Name:   "pdf page tree",
+		Format: PrintWithLeavingControlCharacters,
+		Data: "%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+			"2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 5 >> endobj\n" +
+			"3 0 obj << /Count 2 /Type /Pages /Kids [5 0 R 6 0 R] >> endobj\n" +
+			"5 0 obj << /Type /Page /Parent 3 0 R >> endobj\n",
+		Count: PageCount{Pages: 5, Exact: true},
+	},
+	{
+		Name:   "large pdf page tree",
+		Format: PrintWithLeavingControlCharacters,
+		Data: "%PDF-1.4\n" + strings.Repeat("% filler\n", pdfWindowSize/9) +
+			"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 7 >> endobj\n" + strings.Repeat("% filler\n", pdfWindowSize/9),
+		Count: PageCount{Pages: 7, Exact: true},
+	},
+	{
+		Name:   "large pdf page objects",
+		Format: PrintWithLeavingControlCharacters,
+		Data:   "%PDF-1.5\n" + strings.Repeat("4 0 obj << /Type /Page /Parent 3 0 R >> endobj\n", 5000),
+		Count:  PageCount{Pages: 5000},
+	},
+	{
+		Name:   "pcl form feeds",
+		Format: PrintWithLeavingControlCharacters,
+		Data:   "\x1bEpage 1\fpage 2\f\x1bE",
+		Count:  PageCount{Pages: 2},
+	},
+	{
+		Name:   "text with wrapped lines",
+		Format: PlainTextFile,
+		Width:  10,
+		Data:   strings.Repeat("line\n", 65) + strings.Repeat("x", 25) + "\n",
+		Count:  PageCount{Pages: 2},
+	},
+	{
+		Name:   "text with form feeds",
+		Format: PlainTextFile,
+		Data:   "page 1\fpage 2\n\fpage 3\n",
+		Count:  PageCount{Pages: 3},
+	},
+	{
+		Name:   "text with full page",
+		Format: PlainTextFile,
+		Data:   strings.Repeat("line\n", 66),
+		Count:  PageCount{Pages: 1},
+	},
+	{
+		Name:   "empty text",
+		Format: PlainTextFile,
+		Data:   "",
+		Count:  PageCount{Pages: 0},
+	},
+}
+
+func TestPageCounter(t *testing.T) {
+	counter := &PageCounter{}
+
+	for _, c := range pageCountTestCases {
+		count, err := counter.Count(strings.NewReader(c.Data), c.Format, c.Width)
+		if err != nil {
+			t.Errorf("%s: error while counting pages: %v", c.Name, err)
+		}
+
+		if count != c.Count {
+			t.Errorf("%s: page count is not correct, expected %+v, got %+v", c.Name, c.Count, count)
+		}
+	}
+}
+
+func TestPageCounterJob(t *testing.T) {
+	job := newTestJob(t, strings.Repeat("line\n", 70))
+	// two copies of the data file
+	job.RawControlFile = append(job.RawControlFile, "fdfA007host\n"...)
+
+	count, err := (&PageCounter{}).CountJob(job)
+	if err != nil {
+		t.Fatalf("error while counting pages: %v", err)
+	}
+
+	if count != (PageCount{Pages: 4}) {
+		t.Errorf("page count is not correct, expected 4 estimated pages, got %+v", count)
+	}
+}
@@ -0,0 +1,264 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultPageLength is the number of lines of a page including the header and trailer, like pr uses it
+	DefaultPageLength = 66
+
+	prHeaderLines  = 5
+	prTrailerLines = 5
+	prTabWidth     = 8
+	prDateFormat   = "2006-01-02 15:04"
+)
+
+// PRFormatter paginates text like the pr command, it implements the 'p' output format. Every page starts with
+// a header which contains the date, the title and the page number. The width, indent and title are taken from
+// the control file. Pages shorter than the header and trailer are printed without them, like pr does.
+type PRFormatter struct {
+	// PageLength defaults to DefaultPageLength
+	PageLength int
+	// FormFeed ends a page with a form feed instead of filling it with empty lines
+	FormFeed bool
+	// Date is printed in the header, defaults to the current time
+	Date time.Time
+}
+
+// Filter formats a data file, the title defaults to the source file name of the job
+func (p *PRFormatter) Filter(w io.Writer, r io.Reader, opts FilterOptions) error {
+	if opts.Title == "" && opts.Job != nil {
+		opts.Title = opts.Job.ControlFile[SourceFileName]
+		if opts.Title == "" {
+			opts.Title = opts.Line.File
+		}
+	}
+
+	return p.Format(w, r, opts)
+}
+
+// Document renders a document on the client side, the result is printed with the 'l' command
+func (p *PRFormatter) Document(doc Document, cf ControlFile) (Document, error) {
+	opts := controlFileOptions(cf)
+	if opts.Title == "" {
+		opts.Title = doc.Name
+	}
+
+	buf := new(bytes.Buffer)
+	if err := p.Format(buf, doc.Document, opts); err != nil {
+		return Document{}, err
+	}
+
+	return Document{
+		Document: buf,
+		Size:     buf.Len(),
+		Name:     doc.Name,
+	}, nil
+}
+
+// Format paginates the text of r with the width, indent and title of the options
+func (p *PRFormatter) Format(w io.Writer, r io.Reader, opts FilterOptions) error {
+	pageLength := p.PageLength
+	if pageLength <= 0 {
+		pageLength = DefaultPageLength
+	}
+
+	pg := &prPaginator{
+		w:          bufio.NewWriter(w),
+		formatter:  p,
+		title:      opts.Title,
+		width:      opts.Width,
+		indent:     strings.Repeat(" ", opts.Indent),
+		bodyLength: pageLength - prHeaderLines - prTrailerLines,
+		date:       p.Date,
+	}
+	if pg.width <= 0 {
+		pg.width = DefaultWidth
+	}
+	if pg.bodyLength <= 0 {
+		pg.bodyLength = pageLength
+		pg.noHeader = true
+	}
+	if pg.date.IsZero() {
+		pg.date = time.Now()
+	}
+
+	bodyWidth := pg.width - opts.Indent
+	if bodyWidth < 1 {
+		bodyWidth = 1
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+			segments := strings.Split(line, "\f")
+			for i, segment := range segments {
+				if i > 0 {
+					pg.formFeed()
+				}
+				if segment == "" && len(segments) > 1 {
+					continue
+				}
+
+				for _, part := range foldLine(expandTabs(segment), bodyWidth) {
+					pg.line(part)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if pg.page == 0 {
+		// an empty file is printed as a page with a header, like pr does
+		pg.startPage()
+	}
+	pg.endPage()
+
+	return pg.w.Flush()
+}
+
+type prPaginator struct {
+	w          *bufio.Writer
+	formatter  *PRFormatter
+	title      string
+	width      int
+	indent     string
+	bodyLength int
+	noHeader   bool
+	date       time.Time
+
+	page       int
+	lineOnPage int
+	inPage     bool
+	// filled is set if the last page ended because it was full, a following form feed starts no empty page
+	filled bool
+}
+
+func (pg *prPaginator) startPage() {
+	pg.page++
+	pg.inPage = true
+	pg.filled = false
+	pg.lineOnPage = 0
+
+	if pg.noHeader {
+		return
+	}
+
+	pg.w.WriteString("\n\n")
+	pg.w.WriteString(pg.header())
+	pg.w.WriteString("\n\n\n")
+}
+
+func (pg *prPaginator) header() string {
+	date := pg.date.Format(prDateFormat)
+	page := fmt.Sprintf("Page %d", pg.page)
+
+	space := pg.width - utf8.RuneCountInString(date) - utf8.RuneCountInString(page) - utf8.RuneCountInString(pg.title)
+	if space < 4 {
+		return date + "  " + pg.title + "  " + page
+	}
+
+	left := space / 2
+	return date + strings.Repeat(" ", left) + pg.title + strings.Repeat(" ", space-left) + page
+}
+
+func (pg *prPaginator) line(text string) {
+	if !pg.inPage {
+		pg.startPage()
+	}
+
+	if text != "" {
+		pg.w.WriteString(pg.indent)
+		pg.w.WriteString(text)
+	}
+	pg.w.WriteString("\n")
+
+	pg.lineOnPage++
+	if pg.lineOnPage >= pg.bodyLength {
+		pg.endPage()
+		pg.filled = true
+	}
+}
+
+// formFeed ends the current page, an empty page is printed if there is no current page
+func (pg *prPaginator) formFeed() {
+	if !pg.inPage && pg.filled {
+		pg.filled = false
+		return
+	}
+	if !pg.inPage {
+		pg.startPage()
+	}
+	pg.endPage()
+}
+
+func (pg *prPaginator) endPage() {
+	if !pg.inPage {
+		return
+	}
+	pg.inPage = false
+
+	if pg.formatter.FormFeed {
+		pg.w.WriteString("\f")
+		return
+	}
+
+	padding := pg.bodyLength - pg.lineOnPage
+	if !pg.noHeader {
+		padding += prTrailerLines
+	}
+	pg.w.WriteString(strings.Repeat("\n", padding))
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := prTabWidth - column%prTabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+
+	return b.String()
+}
+
+// foldLine splits a line into parts of at most width runes
+func foldLine(line string, width int) []string {
+	if utf8.RuneCountInString(line) <= width {
+		return []string{line}
+	}
+
+	var parts []string
+	runes := []rune(line)
+	for len(runes) > width {
+		parts = append(parts, string(runes[:width]))
+		runes = runes[width:]
+	}
+
+	return append(parts, string(runes))
+}
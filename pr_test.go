@@ -0,0 +1,74 @@
+package lpd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var prTestDate = time.Date(2019, 3, 4, 5, 6, 0, 0, time.UTC)
+
+func TestPRFormatter(t *testing.T) {
+	p := &PRFormatter{PageLength: 14, Date: prTestDate}
+
+	out := new(bytes.Buffer)
+	opts := FilterOptions{Width: 40, Indent: 2, Title: "report"}
+	if err := p.Format(out, strings.NewReader("one\ntwo\nthree\nfour\nfive\n"), opts); err != nil {
+		t.Fatalf("error while formatting: %v", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	// two pages with 14 lines each, the output ends with a line ending
+	if len(lines) != 2*14+1 {
+		t.Fatalf("expected %d lines, got %d: %q", 2*14+1, len(lines), out.String())
+	}
+
+	expectedHeader := "2019-03-04 05:06      report      Page 1"
+	if lines[2] != expectedHeader {
+		t.Errorf("header is not correct, expected %q, got %q", expectedHeader, lines[2])
+	}
+	if lines[5] != "  one" || lines[8] != "  four" {
+		t.Errorf("body of first page is not correct, got %q", lines[5:9])
+	}
+	if !strings.HasSuffix(lines[14+2], "Page 2") {
+		t.Errorf("header of second page is not correct, got %q", lines[14+2])
+	}
+	if lines[14+5] != "  five" {
+		t.Errorf("body of second page is not correct, got %q", lines[14+5])
+	}
+}
+
+func TestPRFormatterFoldAndFormFeed(t *testing.T) {
+	p := &PRFormatter{PageLength: 5, FormFeed: true, Date: prTestDate}
+
+	out := new(bytes.Buffer)
+	opts := FilterOptions{Width: 4}
+	if err := p.Format(out, strings.NewReader("abcdefgh\tx\f\nnext"), opts); err != nil {
+		t.Fatalf("error while formatting: %v", err)
+	}
+
+	// short pages have no header, the tab is expanded to the next tab stop
+	expected := "abcd\nefgh\n    \n    \nx\n\fnext\n\f"
+	if out.String() != expected {
+		t.Errorf("output is not correct, expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPRFormatterDocument(t *testing.T) {
+	p := &PRFormatter{PageLength: 12, Date: prTestDate}
+
+	doc, err := p.Document(Document{Document: strings.NewReader("text"), Name: "notes.txt"}, ControlFile{WidthOfOutput: "30"})
+	if err != nil {
+		t.Fatalf("error while rendering document: %v", err)
+	}
+
+	data, _ := ioutil.ReadAll(doc.Document)
+	if doc.Size != len(data) {
+		t.Errorf("document size is not correct, expected %d, got %d", len(data), doc.Size)
+	}
+	if !strings.Contains(string(data), "notes.txt") {
+		t.Errorf("header does not contain the document name, got %q", data)
+	}
+}
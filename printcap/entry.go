@@ -0,0 +1,199 @@
+package printcap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/phin1x/go-lpd"
+)
+
+// DefaultMaxSize is the size limit of a data file in blocks of 1024 bytes, if the entry has no mx capability
+const DefaultMaxSize = 1000
+
+// DefaultRemoteQueue is used if an entry has a remote host but no rp capability
+const DefaultRemoteQueue = "lp"
+
+func (e *Entry) Name() string {
+	return e.Names[0]
+}
+
+func (e *Entry) Aliases() []string {
+	return e.Names[1:]
+}
+
+// Capability returns the capability with the name
+func (e *Entry) Capability(name string) (Capability, bool) {
+	for _, c := range e.Capabilities {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return Capability{}, false
+}
+
+// Value returns the value of a string capability
+func (e *Entry) Value(name string) (string, bool) {
+	c, ok := e.Capability(name)
+	if !ok || c.Kind != String {
+		return "", false
+	}
+
+	return c.Value, true
+}
+
+// Number returns the value of a number capability
+func (e *Entry) Number(name string) (int, bool) {
+	c, ok := e.Capability(name)
+	if !ok || c.Kind != Number {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(c.Value)
+	return n, err == nil
+}
+
+// Bool reports whether a boolean capability is set and not turned off
+func (e *Entry) Bool(name string) bool {
+	c, ok := e.Capability(name)
+	return ok && c.Kind == Bool && !c.Off
+}
+
+// Set replaces the capability with the same name or appends it
+func (e *Entry) Set(c Capability) {
+	for i := range e.Capabilities {
+		if e.Capabilities[i].Name == c.Name {
+			e.Capabilities[i] = c
+			return
+		}
+	}
+
+	e.Capabilities = append(e.Capabilities, c)
+}
+
+// Printer holds the capabilities of an entry which are used by this module
+type Printer struct {
+	Name    string
+	Aliases []string
+	// RemoteHost is the rm capability, a port can be appended like host%port
+	RemoteHost string
+	// RemotePort is zero if the rm capability has no port
+	RemotePort int
+	// RemoteQueue is the rp capability, defaults to DefaultRemoteQueue
+	RemoteQueue string
+	// SpoolDir is the sd capability
+	SpoolDir string
+	// Device is the lp capability, like /dev/lp0 or host%port for a network printer
+	Device string
+	// MaxSize is the mx capability in bytes, zero means unlimited
+	MaxSize int64
+	// SuppressBanner is the sh capability
+	SuppressBanner bool
+	// InputFilter is the if capability
+	InputFilter string
+}
+
+// Printer returns the typed capabilities of the entry
+func (e *Entry) Printer() (Printer, error) {
+	p := Printer{
+		Name:           e.Name(),
+		Aliases:        e.Aliases(),
+		RemoteQueue:    DefaultRemoteQueue,
+		MaxSize:        DefaultMaxSize * 1024,
+		SuppressBanner: e.Bool("sh"),
+	}
+	p.SpoolDir, _ = e.Value("sd")
+	p.Device, _ = e.Value("lp")
+	p.InputFilter, _ = e.Value("if")
+
+	if rm, ok := e.Value("rm"); ok {
+		host, port, err := splitHostPort(rm)
+		if err != nil {
+			return Printer{}, fmt.Errorf("printcap: %s: %v", p.Name, err)
+		}
+		p.RemoteHost, p.RemotePort = host, port
+	}
+	if rp, ok := e.Value("rp"); ok && rp != "" {
+		p.RemoteQueue = rp
+	}
+	if mx, ok := e.Number("mx"); ok {
+		p.MaxSize = int64(mx) * 1024
+	}
+
+	return p, nil
+}
+
+// splitHostPort splits an address like host%port, the port is zero if it is missing
+func splitHostPort(addr string) (string, int, error) {
+	i := strings.LastIndex(addr, "%")
+	if i < 0 {
+		return addr, 0, nil
+	}
+
+	port, err := strconv.Atoi(addr[i+1:])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %q", addr)
+	}
+
+	return addr[:i], port, nil
+}
+
+// Client returns a client for the remote printer of the entry and the name of the remote queue
+func (e *Entry) Client() (*lpd.Client, string, error) {
+	p, err := e.Printer()
+	if err != nil {
+		return nil, "", err
+	}
+	if p.RemoteHost == "" {
+		return nil, "", fmt.Errorf("printcap: %s has no remote host", p.Name)
+	}
+
+	port := p.RemotePort
+	if port == 0 {
+		port = 515
+	}
+
+	return lpd.NewClient(p.RemoteHost, port), p.RemoteQueue, nil
+}
+
+// Queue returns a server queue for the entry. Jobs are relayed to the remote printer (rm, rp) or sent to a
+// network printer (lp=host%port) with AppSocket. Banner pages are printed unless sh is set, the input filter (if)
+// filters plain text files. The size limit (mx) is a server wide limit and has to be set by the caller.
+func (e *Entry) Queue() (*lpd.Queue, error) {
+	p, err := e.Printer()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &lpd.Queue{Name: p.Name, Aliases: p.Aliases}
+
+	switch {
+	case p.RemoteHost != "":
+		client, queue, err := e.Client()
+		if err != nil {
+			return nil, err
+		}
+		q.Backend = &lpd.Relay{Client: client, Queue: queue}
+	case strings.Contains(p.Device, "%"):
+		host, port, err := splitHostPort(p.Device)
+		if err != nil {
+			return nil, fmt.Errorf("printcap: %s: %v", p.Name, err)
+		}
+		q.Backend = lpd.NewAppSocket(host, port)
+	default:
+		return nil, fmt.Errorf("printcap: %s has no remote host or network printer", p.Name)
+	}
+
+	if !p.SuppressBanner {
+		q.Banner = &lpd.Banner{}
+	}
+
+	if p.InputFilter != "" {
+		q.Filters = map[lpd.OutputFormat]lpd.Filter{
+			lpd.PlainTextFile: &lpd.CommandFilter{Path: p.InputFilter},
+		}
+	}
+
+	return q, nil
+}
@@ -0,0 +1,312 @@
+// Package printcap reads and writes printcap files, the printer database of the bsd lpd.
+//
+// An entry starts with its names separated by '|', the first one is the printer name, the others are aliases.
+// The capabilities follow separated by ':', long entries are continued on the next line with a backslash:
+//
+//	lp|local|laser printer:\
+//		:rm=printserver:rp=laser:\
+//		:sd=/var/spool/lpd/lp:mx#0:sh:
+//
+// Capabilities are strings (rm=printserver), numbers (mx#0) or booleans (sh), a boolean is turned off with '@'
+// (sh@). Lines starting with '#' are comments, they are kept with the following entry when the file is written.
+package printcap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a capability
+type Kind int
+
+const (
+	Bool Kind = iota
+	Number
+	String
+)
+
+// Capability is a single field of an entry
+type Capability struct {
+	Name string
+	Kind Kind
+	// Value of string and number capabilities, escape sequences are decoded
+	Value string
+	// Off is set for a boolean capability which is turned off, like sh@
+	Off bool
+}
+
+// Entry is a printer of the printcap file
+type Entry struct {
+	// Names holds the printer name followed by its aliases
+	Names        []string
+	Capabilities []Capability
+	// Comments are the comment and empty lines in front of the entry
+	Comments []string
+}
+
+// File is a parsed printcap file
+type File struct {
+	Entries []*Entry
+	// Comments are the comment and empty lines after the last entry
+	Comments []string
+}
+
+// Parse reads a printcap file
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	var comments []string
+	var entry []string
+	start := 0
+	continued := false
+
+	flush := func() error {
+		if entry == nil {
+			return nil
+		}
+
+		e, err := parseEntry(strings.Join(entry, ""))
+		if err != nil {
+			return fmt.Errorf("printcap: line %d: %v", start, err)
+		}
+		e.Comments = comments
+		f.Entries = append(f.Entries, e)
+
+		comments, entry = nil, nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			// a comment ends an entry without continuation
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			comments = append(comments, line)
+			continue
+		case continued:
+		case entry != nil && line != trimmed && (trimmed[0] == ':' || trimmed[0] == '|'):
+			// indented lines starting with a separator continue the entry without a backslash
+		default:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			start = lineNumber
+		}
+
+		continued = strings.HasSuffix(trimmed, "\\") && !strings.HasSuffix(trimmed, "\\\\")
+		entry = append(entry, strings.TrimSuffix(trimmed, "\\"))
+
+		if !continued {
+			// the next line may still continue the entry if it starts with a separator
+			entry = append(entry, ":")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	f.Comments = comments
+
+	return f, nil
+}
+
+func parseEntry(text string) (*Entry, error) {
+	fields := splitFields(text)
+	if len(fields) == 0 || fields[0] == "" {
+		return nil, fmt.Errorf("entry without a name")
+	}
+
+	e := &Entry{}
+	for _, name := range strings.Split(fields[0], "|") {
+		e.Names = append(e.Names, strings.TrimSpace(name))
+	}
+
+	for _, field := range fields[1:] {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		c, err := parseCapability(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Names[0], err)
+		}
+		e.Capabilities = append(e.Capabilities, c)
+	}
+
+	return e, nil
+}
+
+// splitFields splits an entry at the colons which are not escaped
+func splitFields(text string) []string {
+	var fields []string
+	var field strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text):
+			field.WriteByte(text[i])
+			i++
+			field.WriteByte(text[i])
+		case text[i] == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(text[i])
+		}
+	}
+
+	return append(fields, field.String())
+}
+
+func parseCapability(field string) (Capability, error) {
+	i := strings.IndexAny(field, "=#@")
+	if i < 0 {
+		return Capability{Name: field, Kind: Bool}, nil
+	}
+	if i == 0 {
+		return Capability{}, fmt.Errorf("capability without a name %q", field)
+	}
+
+	c := Capability{Name: field[:i]}
+	switch field[i] {
+	case '=':
+		c.Kind = String
+		c.Value = unescape(field[i+1:])
+	case '#':
+		c.Kind = Number
+		c.Value = field[i+1:]
+		if _, err := strconv.Atoi(c.Value); err != nil {
+			return Capability{}, fmt.Errorf("invalid number in %q", field)
+		}
+	case '@':
+		if i != len(field)-1 {
+			return Capability{}, fmt.Errorf("invalid capability %q", field)
+		}
+		c.Kind = Bool
+		c.Off = true
+	}
+
+	return c, nil
+}
+
+var escapes = map[byte]byte{'E': 0x1b, 'n': '\n', 'r': '\r', 't': '\t', 'b': '\b', 'f': '\f', '\\': '\\', ':': ':', '^': '^'}
+
+// unescape decodes the escape sequences of a string capability, like \072 for a colon
+func unescape(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if c, ok := escapes[value[i]]; ok {
+			b.WriteByte(c)
+		} else if i+2 < len(value) && isOctal(value[i:i+3]) {
+			n, _ := strconv.ParseUint(value[i:i+3], 8, 8)
+			b.WriteByte(byte(n))
+			i += 2
+		} else {
+			b.WriteByte(value[i])
+		}
+	}
+
+	return b.String()
+}
+
+func isOctal(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '7' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// escape encodes the characters of a string capability which can not be written as they are
+func escape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\':
+			b.WriteString("\\\\")
+		case c == ':':
+			b.WriteString("\\072")
+		case c == '\n':
+			b.WriteString("\\n")
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// Write writes the printcap file, every capability is put on a line of its own
+func (f *File) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, e := range f.Entries {
+		for _, comment := range e.Comments {
+			bw.WriteString(comment + "\n")
+		}
+
+		bw.WriteString(strings.Join(e.Names, "|") + ":")
+		for _, c := range e.Capabilities {
+			bw.WriteString("\\\n\t:" + c.String() + ":")
+		}
+		bw.WriteString("\n")
+	}
+
+	for _, comment := range f.Comments {
+		bw.WriteString(comment + "\n")
+	}
+
+	return bw.Flush()
+}
+
+func (c Capability) String() string {
+	switch {
+	case c.Kind == String:
+		return c.Name + "=" + escape(c.Value)
+	case c.Kind == Number:
+		return c.Name + "#" + c.Value
+	case c.Off:
+		return c.Name + "@"
+	}
+
+	return c.Name
+}
+
+// Lookup returns the entry with the name or alias, nil if there is none
+func (f *File) Lookup(name string) *Entry {
+	for _, e := range f.Entries {
+		for _, n := range e.Names {
+			if n == name {
+				return e
+			}
+		}
+	}
+
+	return nil
+}
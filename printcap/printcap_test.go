@@ -0,0 +1,137 @@
+package printcap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-lpd"
+)
+
+const testPrintcap = `# printers of the office
+
+# laser printer on the print server
+lp|laser|office laser:\
+	:rm=printserver%1515:rp=laser:\
+	:sd=/var/spool/lpd/lp:mx#0:sh:
+raw:lp=192.168.1.10%9100:sh@:if=/usr/libexec/lpd/textfilter:
+	:cm=colon\072and\\backslash:
+# end
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(testPrintcap))
+	if err != nil {
+		t.Fatalf("error while parsing: %v", err)
+	}
+
+	if len(f.Entries) != 2 {
+		t.Fatalf("expected two entries, got %d", len(f.Entries))
+	}
+
+	lp := f.Lookup("laser")
+	if lp == nil || lp.Name() != "lp" || !reflect.DeepEqual(lp.Aliases(), []string{"laser", "office laser"}) {
+		t.Fatalf("entry was not found by its alias, got %+v", lp)
+	}
+	if !reflect.DeepEqual(lp.Comments, []string{"# printers of the office", "", "# laser printer on the print server"}) {
+		t.Errorf("comments are not correct, got %q", lp.Comments)
+	}
+
+	p, err := lp.Printer()
+	if err != nil {
+		t.Fatalf("error while reading printer: %v", err)
+	}
+	expected := Printer{
+		Name:           "lp",
+		Aliases:        []string{"laser", "office laser"},
+		RemoteHost:     "printserver",
+		RemotePort:     1515,
+		RemoteQueue:    "laser",
+		SpoolDir:       "/var/spool/lpd/lp",
+		SuppressBanner: true,
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("printer is not correct, expected %+v, got %+v", expected, p)
+	}
+
+	raw := f.Lookup("raw")
+	if raw.Bool("sh") {
+		t.Error("turned off boolean is set")
+	}
+	if value, _ := raw.Value("cm"); value != `colon:and\backslash` {
+		t.Errorf("escape sequences are not decoded, got %q", value)
+	}
+	if p, _ := raw.Printer(); p.MaxSize != DefaultMaxSize*1024 {
+		t.Errorf("default size limit is not correct, got %d", p.MaxSize)
+	}
+
+	if !reflect.DeepEqual(f.Comments, []string{"# end"}) {
+		t.Errorf("trailing comments are not correct, got %q", f.Comments)
+	}
+
+	for _, invalid := range []string{"lp:mx#many:", ":rm=host:", "lp:=value:", "lp:sh@x:"} {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Errorf("invalid printcap %q was accepted", invalid)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	f, err := Parse(strings.NewReader(testPrintcap))
+	if err != nil {
+		t.Fatalf("error while parsing: %v", err)
+	}
+	f.Lookup("lp").Set(Capability{Name: "rp", Kind: String, Value: "color"})
+
+	buf := new(bytes.Buffer)
+	if err := f.Write(buf); err != nil {
+		t.Fatalf("error while writing: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "# printers of the office\n\n# laser printer on the print server\nlp|laser|office laser:\\\n\t:rm=printserver%1515:\\\n\t:rp=color:") {
+		t.Errorf("written printcap is not correct, got\n%s", buf.String())
+	}
+
+	written, err := Parse(buf)
+	if err != nil {
+		t.Fatalf("error while parsing written printcap: %v", err)
+	}
+	if !reflect.DeepEqual(written, f) {
+		t.Errorf("written printcap differs, expected %+v, got %+v", f, written)
+	}
+}
+
+func TestEntryQueue(t *testing.T) {
+	f, err := Parse(strings.NewReader(testPrintcap))
+	if err != nil {
+		t.Fatalf("error while parsing: %v", err)
+	}
+
+	q, err := f.Lookup("lp").Queue()
+	if err != nil {
+		t.Fatalf("error while creating queue: %v", err)
+	}
+	relay, ok := q.Backend.(*lpd.Relay)
+	if !ok || relay.Queue != "laser" || q.Banner != nil || !reflect.DeepEqual(q.Aliases, []string{"laser", "office laser"}) {
+		t.Errorf("relay queue is not correct, got %+v", q)
+	}
+
+	q, err = f.Lookup("raw").Queue()
+	if err != nil {
+		t.Fatalf("error while creating queue: %v", err)
+	}
+	appSocket, ok := q.Backend.(*lpd.AppSocket)
+	if !ok || appSocket.Addr != "192.168.1.10:9100" || q.Banner == nil || q.Filters[lpd.PlainTextFile] == nil {
+		t.Errorf("appsocket queue is not correct, got %+v", q)
+	}
+
+	if _, _, err := f.Lookup("raw").Client(); err == nil {
+		t.Error("client for an entry without remote host was created")
+	}
+
+	local := &Entry{Names: []string{"local"}, Capabilities: []Capability{{Name: "lp", Kind: String, Value: "/dev/lp0"}}}
+	if _, err := local.Queue(); err == nil {
+		t.Error("queue for a local device was created")
+	}
+}
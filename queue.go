@@ -0,0 +1,689 @@
+package lpd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Backend delivers the jobs of a queue to their destination
+type Backend interface {
+	Deliver(job *Job) error
+}
+
+// QueueStater is implemented by backends which answer queue state requests themselves, e.g. by asking an upstream server
+type QueueStater interface {
+	QueueState(w io.Writer, queue string, long bool, list []string) error
+}
+
+// JobRemover is implemented by backends which forward remove requests to their destination
+type JobRemover interface {
+	RemoveJobs(queue, agent string, list []string) error
+}
+
+var DefaultRetryInterval = 30 * time.Second
+
+// DefaultNotifyTimeout limits how long a notification may take, the queue logs it as failed afterwards
+var DefaultNotifyTimeout = 30 * time.Second
+
+// Queue is a printer queue of the server, received jobs are stored until its backend delivered them
+type Queue struct {
+	Name string
+	// Aliases are further names of the queue, like the names of a printcap entry after the first one
+	Aliases []string
+	Backend Backend
+	// RetryInterval is the delay between two delivery attempts of a job, defaults to DefaultRetryInterval
+	RetryInterval time.Duration
+	// MaxAttempts limits the delivery attempts of a job, zero means the job is kept until it could be delivered
+	MaxAttempts int
+	// Filters convert the data files of a job by their output format before they are passed to the backend
+	Filters map[OutputFormat]Filter
+	// Banner is printed before the data files of jobs which request a banner page
+	Banner *Banner
+	// Notifier is informed about the result of jobs with a mail when printed command ('M'), the notifications are
+	// sent in the background
+	Notifier Notifier
+	// NotifyTimeout defaults to DefaultNotifyTimeout
+	NotifyTimeout time.Duration
+	// Accounting receives a record for every job the queue is done with
+	Accounting Accounter
+	// PageCounter estimates the pages of the accounting records
+	PageCounter *PageCounter
+	// Quota rejects jobs which exceed the limits of the user or the queue
+	Quota *Quota
+	// ACL restricts the hosts and users which may use the queue
+	ACL *ACL
+	// ErrorLog receives the errors of the notifier, the accounting, the quota store and the job files in the spool
+	// directory, the standard logger is used if it is nil
+	ErrorLog *log.Logger
+
+	mu       sync.Mutex
+	jobs     []*Job
+	active   *Job
+	canceled bool
+	wakeup   chan struct{}
+	// retry interrupts the delay before the next delivery attempt
+	retry chan struct{}
+	// disabled queues reject new jobs, the jobs of stopped queues are not delivered
+	disabled    bool
+	printingOff bool
+	// removed is closed when the queue is removed from the server, the worker stops once the queue is empty
+	removed chan struct{}
+	stopped bool
+	// replaced is set when the waiting jobs moved to a replacement, later jobs go to the replacement too
+	replaced bool
+}
+
+func (q *Queue) init() {
+	q.wakeup = make(chan struct{}, 1)
+	q.retry = make(chan struct{}, 1)
+	q.removed = make(chan struct{})
+}
+
+// Jobs returns the jobs waiting in the queue, the active job is the first one
+func (q *Queue) Jobs() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*Job, len(q.jobs))
+	copy(jobs, q.jobs)
+	return jobs
+}
+
+// add queues the job, it returns false if the queue was replaced or removed and its worker stopped while the job
+// was received
+func (q *Queue) add(job *Job) bool {
+	q.mu.Lock()
+	if q.stopped || q.replaced {
+		q.mu.Unlock()
+		return false
+	}
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+
+	q.wake()
+	return true
+}
+
+// restart queues a job of a removed queue whose worker stopped, it reports whether the worker has to be started
+// again
+func (q *Queue) restart(job *Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.jobs = append(q.jobs, job)
+	stopped := q.stopped
+	q.stopped = false
+
+	return stopped
+}
+
+// moveTo moves the waiting jobs and the enabled and printing state to a queue which is not started yet
+func (q *Queue) moveTo(to *Queue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range q.jobs {
+		if job != q.active {
+			jobs = append(jobs, job)
+		}
+	}
+
+	q.jobs = q.jobs[:0]
+	if q.active != nil {
+		q.jobs = append(q.jobs, q.active)
+	}
+
+	to.jobs = append(jobs, to.jobs...)
+	to.disabled = q.disabled
+	to.printingOff = q.printingOff
+	q.replaced = true
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// remove deletes the jobs matching the list, only root may remove jobs of other users
+func (q *Queue) remove(agent string, list []string) []*Job {
+	q.mu.Lock()
+
+	var removed []*Job
+	kept := q.jobs[:0]
+
+	for i, job := range q.jobs {
+		selected := job.matches(list)
+		if len(list) == 0 {
+			// without a list only the active job is removed
+			selected = i == 0 && job == q.active
+		}
+
+		if selected && (agent == "root" || agent == job.ControlFile[UserID]) {
+			removed = append(removed, job)
+			if job == q.active {
+				q.canceled = true
+			}
+			continue
+		}
+
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+	active := q.active
+	q.mu.Unlock()
+
+	// the active job is finished by the worker, the waiting jobs were never started
+	for _, job := range removed {
+		if job != active {
+			pages := q.countPages(job)
+			job.Remove()
+			q.account(job, time.Now(), pages, ErrJobRemoved)
+			q.notify(job, ErrJobRemoved)
+		}
+	}
+
+	return removed
+}
+
+// QueueStatus is the administrative state of a queue
+type QueueStatus struct {
+	Name string
+	// Queuing is false if the queue rejects new jobs
+	Queuing bool
+	// Printing is false if the jobs are not delivered
+	Printing bool
+	Jobs     int
+	Held     int
+}
+
+func (q *Queue) Status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := QueueStatus{Name: q.Name, Queuing: !q.disabled, Printing: !q.printingOff, Jobs: len(q.jobs)}
+	for _, job := range q.jobs {
+		if job.held {
+			status.Held++
+		}
+	}
+
+	return status
+}
+
+// Enable lets the queue accept new jobs again
+func (q *Queue) Enable() {
+	q.mu.Lock()
+	q.disabled = false
+	q.mu.Unlock()
+}
+
+// Disable rejects new jobs, the waiting jobs are still delivered
+func (q *Queue) Disable() {
+	q.mu.Lock()
+	q.disabled = true
+	q.mu.Unlock()
+}
+
+func (q *Queue) isDisabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.disabled
+}
+
+// Start resumes the delivery of jobs
+func (q *Queue) Start() {
+	q.mu.Lock()
+	q.printingOff = false
+	q.mu.Unlock()
+
+	q.wake()
+}
+
+// Stop pauses the delivery of jobs after the active job, new jobs are still accepted
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.printingOff = true
+	q.mu.Unlock()
+}
+
+// Restart starts the delivery of jobs and retries the active job right away, if it waits for its next attempt
+func (q *Queue) Restart() {
+	q.Start()
+
+	select {
+	case q.retry <- struct{}{}:
+	default:
+	}
+}
+
+// Hold keeps the jobs matching the list of user names and job numbers in the queue until they are released,
+// the active job can not be held
+func (q *Queue) Hold(list ...string) error {
+	return q.setHeld(list, true)
+}
+
+func (q *Queue) Release(list ...string) error {
+	err := q.setHeld(list, false)
+	q.wake()
+
+	return err
+}
+
+func (q *Queue) setHeld(list []string, held bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	matched := false
+	for _, job := range q.jobs {
+		if job != q.active && job.matches(list) {
+			job.held = held
+			matched = true
+			q.save(job)
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("no job in queue %s matches %v", q.Name, list)
+	}
+
+	return nil
+}
+
+// Topq moves the jobs matching the list of user names and job numbers to the front of the queue, behind the
+// active job. A moved job is released if it was held.
+func (q *Queue) Topq(list ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var front, rest []*Job
+	for _, job := range q.jobs {
+		if job == q.active {
+			front = append([]*Job{job}, front...)
+		} else if job.matches(list) {
+			if job.held {
+				job.held = false
+				q.save(job)
+			}
+			front = append(front, job)
+		} else {
+			rest = append(rest, job)
+		}
+	}
+
+	if len(front) == 0 || (len(front) == 1 && front[0] == q.active) {
+		return fmt.Errorf("no job in queue %s matches %v", q.Name, list)
+	}
+	q.jobs = append(front, rest...)
+
+	return nil
+}
+
+// save writes the changed state of the job to its job file, q.mu must be held
+func (q *Queue) save(job *Job) {
+	if err := job.save(); err != nil {
+		q.logf("lpd: could not save job %03d of queue %s: %v", job.Number, q.Name, err)
+	}
+}
+
+// next selects the first job which is not held, it is moved to the front of the queue
+func (q *Queue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.printingOff {
+		return nil
+	}
+
+	for i, job := range q.jobs {
+		if job.held {
+			continue
+		}
+
+		copy(q.jobs[1:i+1], q.jobs[:i])
+		q.jobs[0] = job
+		q.active = job
+		q.canceled = false
+		return job
+	}
+
+	return nil
+}
+
+func (q *Queue) finish(job *Job, result error) {
+	q.mu.Lock()
+	for i, j := range q.jobs {
+		if j == job {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			break
+		}
+	}
+	q.active = nil
+	q.mu.Unlock()
+
+	job.Remove()
+	q.notify(job, result)
+}
+
+func (q *Queue) notify(job *Job, result error) {
+	address, ok := job.ControlFile[MailWhenPrinted]
+	if !ok || address == "" || q.Notifier == nil {
+		return
+	}
+
+	n := Notification{Address: address, Job: job, Err: result}
+
+	go func() {
+		notified := make(chan error, 1)
+		go func() {
+			notified <- q.Notifier.Notify(n)
+		}()
+
+		timer := time.NewTimer(q.notifyTimeout())
+		defer timer.Stop()
+
+		select {
+		case err := <-notified:
+			if err != nil {
+				q.logf("lpd: could not notify %s about job %03d of queue %s: %v", address, job.Number, q.Name, err)
+			}
+		case <-timer.C:
+			q.logf("lpd: notification of %s about job %03d of queue %s timed out", address, job.Number, q.Name)
+		}
+	}()
+}
+
+func (q *Queue) notifyTimeout() time.Duration {
+	if q.NotifyTimeout > 0 {
+		return q.NotifyTimeout
+	}
+
+	return DefaultNotifyTimeout
+}
+
+func (q *Queue) logf(format string, args ...interface{}) {
+	if q.ErrorLog != nil {
+		q.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// stopIfEmpty marks the worker as stopped if the queue is empty
+func (q *Queue) stopIfEmpty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.jobs) > 0 {
+		return false
+	}
+	q.stopped = true
+
+	return true
+}
+
+func (q *Queue) isCanceled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.canceled
+}
+
+func (q *Queue) retryInterval() time.Duration {
+	if q.RetryInterval > 0 {
+		return q.RetryInterval
+	}
+
+	return DefaultRetryInterval
+}
+
+// run delivers the queued jobs one after another until done is closed or the queue is removed and empty
+func (q *Queue) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		job := q.next()
+		if job == nil {
+			select {
+			case <-q.wakeup:
+				continue
+			case <-q.removed:
+				if q.stopIfEmpty() {
+					return
+				}
+				continue
+			case <-done:
+				return
+			}
+		}
+
+		if !q.process(job, done) {
+			return
+		}
+	}
+}
+
+// process tries to deliver the job, it returns false if done was closed while waiting for the next attempt
+func (q *Queue) process(job *Job, done <-chan struct{}) bool {
+	var err error
+	started := time.Now()
+	if job.delivered == nil {
+		// created before the copies of the filters and the banner, so they record the delivered parts in it
+		job.delivered = make(map[int]bool)
+	}
+	for attempt := 1; ; attempt++ {
+		err = q.deliver(job)
+		if err == nil || q.isCanceled() || (q.MaxAttempts > 0 && attempt >= q.MaxAttempts) {
+			break
+		}
+
+		select {
+		case <-time.After(q.retryInterval()):
+		case <-q.retry:
+		case <-done:
+			return false
+		}
+
+		if q.isCanceled() {
+			break
+		}
+	}
+
+	if err != nil && q.isCanceled() {
+		err = ErrJobRemoved
+	}
+
+	pages := q.countPages(job)
+	if err == nil && job.quota != nil {
+		// the reservation was made by the quota the job was received with
+		if err := job.quota.count(job); err != nil {
+			q.logf("lpd: could not count the quota usage of job %03d of queue %s: %v", job.Number, q.Name, err)
+		}
+	}
+
+	q.finish(job, err)
+	q.account(job, started, pages, err)
+
+	return true
+}
+
+// countPages counts the pages for the accounting record, before the data files of the job are removed
+func (q *Queue) countPages(job *Job) PageCount {
+	var pages PageCount
+	if q.Accounting != nil && q.PageCounter != nil {
+		pages, _ = q.PageCounter.CountJob(job)
+	}
+
+	return pages
+}
+
+// account emits the accounting record of a job the queue is done with
+func (q *Queue) account(job *Job, started time.Time, pages PageCount, result error) {
+	if q.Accounting == nil {
+		return
+	}
+
+	record := newAccountingRecord(job, started, result)
+	record.Pages, record.PagesExact = pages.Pages, pages.Exact
+	if err := q.Accounting.Account(record); err != nil {
+		q.logf("lpd: could not account job %03d of queue %s: %v", job.Number, q.Name, err)
+	}
+}
+
+// deliver passes the job through the filters and adds the banner page before it is delivered to the backend
+func (q *Queue) deliver(job *Job) error {
+	var created []*DataFile
+	defer func() {
+		removeDataFiles(created)
+	}()
+
+	if len(q.Filters) > 0 {
+		filtered, files, err := filterJob(job, q.Filters)
+		if err != nil {
+			return err
+		}
+		job = filtered
+		created = append(created, files...)
+	}
+
+	if _, ok := job.ControlFile[PrintBanner]; ok && q.Banner != nil {
+		bannered, banner, err := q.Banner.addTo(job)
+		if err != nil {
+			return err
+		}
+		job = bannered
+		if banner != nil {
+			created = append(created, banner)
+		}
+	}
+
+	return q.Backend.Deliver(job)
+}
+
+// writeState writes the queue state in the format of the bsd lpq command
+func (q *Queue) writeState(w io.Writer, long bool, list []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range q.jobs {
+		if job.matches(list) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if q.disabled {
+		if _, err := fmt.Fprintf(w, "Warning: %s queue is turned off\n", q.Name); err != nil {
+			return err
+		}
+	}
+
+	if q.printingOff {
+		if _, err := fmt.Fprintf(w, "%s is down\n", q.Name); err != nil {
+			return err
+		}
+	} else if q.active != nil {
+		if _, err := fmt.Fprintf(w, "%s is ready and printing\n", q.Name); err != nil {
+			return err
+		}
+	} else if _, err := fmt.Fprintf(w, "%s is ready\n", q.Name); err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		_, err := fmt.Fprint(w, "no entries\n")
+		return err
+	}
+
+	if !long {
+		if _, err := fmt.Fprintf(w, "%-7s%-11s%-5s%-38s%s\n", "Rank", "Owner", "Job", "Files", "Total Size"); err != nil {
+			return err
+		}
+	}
+
+	for i, job := range jobs {
+		rank := rankName(i + 1)
+		if job == q.active {
+			rank = "active"
+		} else if job.held {
+			rank = "held"
+		}
+
+		var err error
+		if long {
+			err = writeLongEntry(w, rank, job)
+		} else {
+			_, err = fmt.Fprintf(w, "%-7s%-11s%-5d%-38s%d bytes\n", rank, job.ControlFile[UserID], job.Number, jobFiles(job), job.Size())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeLongEntry(w io.Writer, rank string, job *Job) error {
+	header := fmt.Sprintf("%s: %s", job.ControlFile[UserID], rank)
+	// a long header is separated from the job by a single space
+	if _, err := fmt.Fprintf(w, "\n%-40s [job %03d%s]\n", header, job.Number, job.ControlFile[Hostname]); err != nil {
+		return err
+	}
+
+	for _, df := range job.DataFiles {
+		if _, err := fmt.Fprintf(w, "\t%-32s %d bytes\n", dataFileTitle(job, df), df.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func jobFiles(job *Job) string {
+	if name, ok := job.ControlFile[JobName]; ok && name != "" {
+		return name
+	}
+
+	var files string
+	for i, df := range job.DataFiles {
+		if i > 0 {
+			files += ", "
+		}
+		files += dataFileTitle(job, df)
+	}
+
+	return files
+}
+
+func dataFileTitle(job *Job, df *DataFile) string {
+	if name, ok := job.ControlFile[SourceFileName]; ok && name != "" {
+		return name
+	}
+
+	return df.Name
+}
+
+func rankName(rank int) string {
+	suffix := "th"
+	switch {
+	case rank%100 >= 11 && rank%100 <= 13:
+	case rank%10 == 1:
+		suffix = "st"
+	case rank%10 == 2:
+		suffix = "nd"
+	case rank%10 == 3:
+		suffix = "rd"
+	}
+
+	return fmt.Sprintf("%d%s", rank, suffix)
+}
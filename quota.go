@@ -0,0 +1,314 @@
+package lpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimit limits the usage in a period, zero values are unlimited
+type QuotaLimit struct {
+	Pages int64
+	Bytes int64
+	// Period after which the usage starts again at zero, zero means the usage is never reset
+	Period time.Duration
+}
+
+func (l QuotaLimit) unlimited() bool {
+	return l.Pages == 0 && l.Bytes == 0
+}
+
+// periodStart returns the start of the current period
+func (l QuotaLimit) periodStart(now time.Time) time.Time {
+	if l.Period <= 0 {
+		return time.Time{}
+	}
+
+	return now.Truncate(l.Period)
+}
+
+type QuotaUsage struct {
+	Pages int64 `json:"pages"`
+	Bytes int64 `json:"bytes"`
+}
+
+// QuotaStore keeps the usage counters, the key identifies a user or a queue
+type QuotaStore interface {
+	Usage(key string, period time.Time) (QuotaUsage, error)
+	Add(key string, period time.Time, usage QuotaUsage) error
+}
+
+// Quota limits the jobs of a queue. The limits are checked when the control file arrives and when a data file
+// is announced, jobs which exceed them are rejected. The usage of a received job is reserved until the job is
+// delivered and counted, or removed.
+type Quota struct {
+	// User limits the jobs of every user ('P'), the usage is shared by all queues with the same store
+	User QuotaLimit
+	// Queue limits all jobs of the queue
+	Queue QuotaLimit
+	// PageCounter counts the pages of delivered jobs, defaults to a counter with the default page length
+	PageCounter *PageCounter
+	// Store defaults to a store in memory
+	Store QuotaStore
+
+	once sync.Once
+	// mu guards reserved, which holds the usage of the received jobs which were not delivered yet by key
+	mu       sync.Mutex
+	reserved map[string]QuotaUsage
+}
+
+func (q *Quota) store() QuotaStore {
+	q.once.Do(func() {
+		if q.Store == nil {
+			q.Store = NewMemoryQuotaStore()
+		}
+	})
+
+	return q.Store
+}
+
+func quotaUserKey(user string) string {
+	return "user:" + user
+}
+
+func quotaQueueKey(queue string) string {
+	return "queue:" + queue
+}
+
+// Check returns ErrQuotaExceeded if a job of the user with the given size exceeds a limit
+func (q *Quota) Check(user, queue string, size int64) error {
+	if err := q.check(q.User, quotaUserKey(user), size); err != nil {
+		return fmt.Errorf("%v for user %s", err, user)
+	}
+	if err := q.check(q.Queue, quotaQueueKey(queue), size); err != nil {
+		return fmt.Errorf("%v for queue %s", err, queue)
+	}
+
+	return nil
+}
+
+func (q *Quota) check(limit QuotaLimit, key string, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// the pages are counted when the job is complete, until then a job needs at least one page
+	return q.checkLocked(limit, key, QuotaUsage{Pages: 1, Bytes: size})
+}
+
+// checkLocked checks whether a job with the given usage fits in the usage of the store and the reserved usage,
+// q.mu must be held
+func (q *Quota) checkLocked(limit QuotaLimit, key string, job QuotaUsage) error {
+	if limit.unlimited() {
+		return nil
+	}
+
+	usage, err := q.store().Usage(key, limit.periodStart(time.Now()))
+	if err != nil {
+		return err
+	}
+	usage.Pages += q.reserved[key].Pages
+	usage.Bytes += q.reserved[key].Bytes
+
+	if limit.Bytes > 0 && usage.Bytes+job.Bytes > limit.Bytes {
+		return ErrQuotaExceeded
+	}
+	if limit.Pages > 0 && usage.Pages+job.Pages > limit.Pages {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// checkJob checks the announced size of the job including a data file which is announced next
+func (q *Quota) checkJob(job *Job, announced int64) error {
+	if job.ControlFile == nil {
+		// the user is unknown until the control file arrives, only the queue limit can be checked
+		return q.check(q.Queue, quotaQueueKey(job.Queue), job.Size()+announced)
+	}
+
+	return q.Check(job.ControlFile[UserID], job.Queue, job.Size()+announced)
+}
+
+// reserve checks the complete job against the limits and reserves its usage, so jobs received at the same time
+// can not exceed a limit together. The reservation is released when the job is counted or removed.
+func (q *Quota) reserve(job *Job) error {
+	counter := q.PageCounter
+	if counter == nil {
+		counter = &PageCounter{}
+	}
+
+	pages, err := counter.CountJob(job)
+	if err != nil {
+		return err
+	}
+
+	user := job.ControlFile[UserID]
+	usage := QuotaUsage{Pages: int64(pages.Pages), Bytes: job.Size()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.checkLocked(q.User, quotaUserKey(user), usage); err != nil {
+		return fmt.Errorf("%v for user %s", err, user)
+	}
+	if err := q.checkLocked(q.Queue, quotaQueueKey(job.Queue), usage); err != nil {
+		return fmt.Errorf("%v for queue %s", err, job.Queue)
+	}
+
+	if q.reserved == nil {
+		q.reserved = make(map[string]QuotaUsage)
+	}
+	q.addReserved(quotaUserKey(user), usage)
+	q.addReserved(quotaQueueKey(job.Queue), usage)
+
+	job.quota = q
+	job.reserved = usage
+
+	return nil
+}
+
+// addReserved adds the usage to the reservation of the key, a negative usage releases it. q.mu must be held.
+func (q *Quota) addReserved(key string, usage QuotaUsage) {
+	reserved := q.reserved[key]
+	reserved.Pages += usage.Pages
+	reserved.Bytes += usage.Bytes
+
+	if reserved == (QuotaUsage{}) {
+		delete(q.reserved, key)
+	} else {
+		q.reserved[key] = reserved
+	}
+}
+
+// release drops the reservation of the job
+func (q *Quota) release(job *Job) {
+	if job.quota != q {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	released := QuotaUsage{Pages: -job.reserved.Pages, Bytes: -job.reserved.Bytes}
+	q.addReserved(quotaUserKey(job.ControlFile[UserID]), released)
+	q.addReserved(quotaQueueKey(job.Queue), released)
+
+	job.quota = nil
+	job.reserved = QuotaUsage{}
+}
+
+// count adds the reserved usage of a delivered job to the store and releases the reservation
+func (q *Quota) count(job *Job) error {
+	usage := job.reserved
+	defer q.release(job)
+
+	now := time.Now()
+
+	if !q.User.unlimited() {
+		if err := q.store().Add(quotaUserKey(job.ControlFile[UserID]), q.User.periodStart(now), usage); err != nil {
+			return err
+		}
+	}
+	if !q.Queue.unlimited() {
+		return q.store().Add(quotaQueueKey(job.Queue), q.Queue.periodStart(now), usage)
+	}
+
+	return nil
+}
+
+type quotaEntry struct {
+	Period time.Time  `json:"period"`
+	Usage  QuotaUsage `json:"usage"`
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{entries: make(map[string]quotaEntry)}
+}
+
+// MemoryQuotaStore keeps the usage of the current period of every key
+type MemoryQuotaStore struct {
+	mu      sync.Mutex
+	entries map[string]quotaEntry
+}
+
+func (m *MemoryQuotaStore) Usage(key string, period time.Time) (QuotaUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || !entry.Period.Equal(period) {
+		return QuotaUsage{}, nil
+	}
+
+	return entry.Usage, nil
+}
+
+func (m *MemoryQuotaStore) Add(key string, period time.Time, usage QuotaUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.add(key, period, usage)
+	return nil
+}
+
+func (m *MemoryQuotaStore) add(key string, period time.Time, usage QuotaUsage) {
+	entry := m.entries[key]
+	if !entry.Period.Equal(period) {
+		// a new period starts with zero usage
+		entry = quotaEntry{Period: period}
+	}
+
+	entry.Usage.Pages += usage.Pages
+	entry.Usage.Bytes += usage.Bytes
+	m.entries[key] = entry
+}
+
+// NewFileQuotaStore loads the usage counters from a json file, the file is created on the first update
+func NewFileQuotaStore(path string) (*FileQuotaStore, error) {
+	store := &FileQuotaStore{MemoryQuotaStore: NewMemoryQuotaStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, fmt.Errorf("could not decode quota file %s: %v", path, err)
+	}
+
+	return store, nil
+}
+
+// FileQuotaStore is a memory store which writes the counters to a json file on every update
+type FileQuotaStore struct {
+	*MemoryQuotaStore
+	path string
+}
+
+func (f *FileQuotaStore) Add(key string, period time.Time, usage QuotaUsage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.add(key, period, usage)
+
+	data, err := json.Marshal(f.entries)
+	if err != nil {
+		return err
+	}
+
+	// replace the file at once, so a crash does not leave a partial file
+	if err := writeFile(f.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.path+".tmp", f.path)
+}
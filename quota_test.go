@@ -0,0 +1,163 @@
+package lpd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotaCheck(t *testing.T) {
+	quota := &Quota{
+		User:  QuotaLimit{Bytes: 100, Pages: 2, Period: time.Hour},
+		Queue: QuotaLimit{Bytes: 150},
+	}
+
+	if err := quota.Check("alice", "lp", 100); err != nil {
+		t.Errorf("job within the limit was rejected: %v", err)
+	}
+	if err := quota.Check("alice", "lp", 101); err == nil {
+		t.Error("job above the user byte limit was accepted")
+	}
+
+	now := time.Now()
+	quota.store().Add(quotaUserKey("alice"), quota.User.periodStart(now), QuotaUsage{Pages: 2, Bytes: 10})
+	quota.store().Add(quotaQueueKey("lp"), quota.Queue.periodStart(now), QuotaUsage{Bytes: 100})
+
+	if err := quota.Check("alice", "lp", 1); err == nil {
+		t.Error("job of a user without pages left was accepted")
+	}
+	if err := quota.Check("bob", "lp", 50); err != nil {
+		t.Errorf("job of another user within the limit was rejected: %v", err)
+	}
+	if err := quota.Check("bob", "lp", 51); err == nil {
+		t.Error("job above the queue byte limit was accepted")
+	}
+
+	// the usage of a past period does not count
+	store := NewMemoryQuotaStore()
+	store.Add("user:alice", now.Add(-2*time.Hour).Truncate(time.Hour), QuotaUsage{Pages: 10})
+	if usage, _ := store.Usage("user:alice", now.Truncate(time.Hour)); usage != (QuotaUsage{}) {
+		t.Errorf("usage of past period is counted, got %+v", usage)
+	}
+}
+
+func TestFileQuotaStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	period := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatalf("error while creating store: %v", err)
+	}
+	if err := store.Add("user:alice", period, QuotaUsage{Pages: 3, Bytes: 300}); err != nil {
+		t.Fatalf("error while adding usage: %v", err)
+	}
+
+	store, err = NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatalf("error while loading store: %v", err)
+	}
+
+	usage, err := store.Usage("user:alice", period)
+	if err != nil {
+		t.Fatalf("error while getting usage: %v", err)
+	}
+	if usage != (QuotaUsage{Pages: 3, Bytes: 300}) {
+		t.Errorf("usage was not persisted, got %+v", usage)
+	}
+}
+
+func TestServerQuota(t *testing.T) {
+	finished := make(chan AccountingRecord, 1)
+	accounting := AccounterFunc(func(record AccountingRecord) error {
+		finished <- record
+		return nil
+	})
+
+	_, client := startTestServer(t, &Queue{
+		Name:       "lp",
+		Backend:    newRecordingBackend(),
+		Quota:      &Quota{User: QuotaLimit{Bytes: 10}},
+		Accounting: accounting,
+	})
+
+	printJob := func(user string) error {
+		return client.PrintDocument(Document{
+			Document: strings.NewReader("12345678"),
+			Size:     8,
+			Name:     "data.txt",
+		}, "lp", ControlFile{UserID: user}, PlainTextFile)
+	}
+
+	if err := printJob("alice"); err != nil {
+		t.Fatalf("first job was rejected: %v", err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first job was not delivered")
+	}
+
+	if err := printJob("alice"); err == nil {
+		t.Error("job above the quota was accepted")
+	}
+	if err := printJob("bob"); err != nil {
+		t.Errorf("job of another user was rejected: %v", err)
+	}
+}
+
+func TestServerQuotaReservation(t *testing.T) {
+	queue := &Queue{
+		Name:    "lp",
+		Backend: newRecordingBackend(),
+		Quota:   &Quota{User: QuotaLimit{Bytes: 10}},
+	}
+	queue.Stop()
+	_, client := startTestServer(t, queue)
+
+	printJob := func(user string) error {
+		return client.PrintDocument(Document{
+			Document: strings.NewReader("12345678"),
+			Size:     8,
+			Name:     "data.txt",
+		}, "lp", ControlFile{UserID: user}, PlainTextFile)
+	}
+
+	if err := printJob("alice"); err != nil {
+		t.Fatalf("first job was rejected: %v", err)
+	}
+	// the first job waits in the stopped queue, its usage is reserved already
+	if err := printJob("alice"); err == nil {
+		t.Error("job above the reserved quota was accepted")
+	}
+
+	if err := client.RemoveJobs("lp", "alice", nil, []string{"alice"}); err != nil {
+		t.Fatalf("error while removing the jobs: %v", err)
+	}
+	if err := printJob("alice"); err != nil {
+		t.Errorf("job was rejected after the reservation was released: %v", err)
+	}
+}
+
+func TestQuotaReservePages(t *testing.T) {
+	quota := &Quota{User: QuotaLimit{Pages: 1}}
+
+	if err := quota.reserve(newTestJob(t, strings.Repeat("line\n", 66*9))); err == nil {
+		t.Error("job with more pages than the limit was accepted")
+	}
+
+	job := newTestJob(t, "line\n")
+	if err := quota.reserve(job); err != nil {
+		t.Fatalf("job within the page limit was rejected: %v", err)
+	}
+	if err := quota.reserve(newTestJob(t, "line\n")); err == nil {
+		t.Error("job above the reserved pages was accepted")
+	}
+
+	job.Remove()
+	if err := quota.reserve(newTestJob(t, "line\n")); err != nil {
+		t.Errorf("job was rejected after the reservation was released: %v", err)
+	}
+}
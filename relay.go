@@ -0,0 +1,152 @@
+package lpd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DefaultRelayTimeout limits the dial and every read and write of a connection to the upstream server
+var DefaultRelayTimeout = time.Minute
+
+// Relay is a backend which forwards the jobs of a queue to an upstream lpd server.
+// Every print line of a job is sent as a separate document, a retry only sends the lines
+// which were not delivered yet. Queue state and remove requests are passed through to the
+// upstream server.
+type Relay struct {
+	Client *Client
+	// Queue is the name of the upstream queue, the local queue name is used if it is empty
+	Queue string
+	// Hostname and UserID replace the host and user of the forwarded control files if they are not empty,
+	// UserID replaces the user of the banner page too
+	Hostname string
+	UserID   string
+	// Timeout is used if the client has no timeout, defaults to DefaultRelayTimeout
+	Timeout time.Duration
+}
+
+// client returns the client with a timeout, so a stalled upstream server does not block the queue
+func (r *Relay) client() *Client {
+	if r.Client.Timeout > 0 {
+		return r.Client
+	}
+
+	client := *r.Client
+	client.Timeout = r.Timeout
+	if client.Timeout <= 0 {
+		client.Timeout = DefaultRelayTimeout
+	}
+
+	return &client
+}
+
+func (r *Relay) Deliver(job *Job) error {
+	cf := r.controlFile(job)
+	queue := r.queue(job.Queue)
+	client := r.client()
+
+	for i, line := range job.PrintLines() {
+		df := job.DataFile(line.File)
+		if df == nil || job.isDelivered(i) {
+			continue
+		}
+
+		if err := r.forward(client, df, queue, cf, line.Format); err != nil {
+			return err
+		}
+		job.setDelivered(i)
+	}
+
+	return nil
+}
+
+func (r *Relay) forward(client *Client, df *DataFile, queue string, cf ControlFile, of OutputFormat) error {
+	f, err := df.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := df.Name
+	if sourceName, ok := cf[SourceFileName]; ok {
+		name = sourceName
+	}
+
+	// a banner page is only requested if the job asked for one
+	_, banner := cf[PrintBanner]
+
+	return client.PrintDocumentWithOptions(Document{
+		Document: f,
+		Size:     int(df.Size),
+		Name:     name,
+	}, queue, cf, of, PrintOptions{NoBanner: !banner})
+}
+
+// controlFile returns the control file lines which are forwarded, the client creates the file names itself
+func (r *Relay) controlFile(job *Job) ControlFile {
+	cf := make(ControlFile)
+	for cmd, value := range job.ControlFile {
+		if cmd.IsOutputFormat() || cmd == UnlinkDataFile {
+			continue
+		}
+		cf[cmd] = value
+	}
+
+	if r.Hostname != "" {
+		cf[Hostname] = r.Hostname
+	}
+	if r.UserID != "" {
+		cf[UserID] = r.UserID
+		if _, ok := cf[PrintBanner]; ok {
+			cf[PrintBanner] = r.UserID
+		}
+	}
+
+	return cf
+}
+
+func (r *Relay) queue(name string) string {
+	if r.Queue != "" {
+		return r.Queue
+	}
+
+	return name
+}
+
+func (r *Relay) QueueState(w io.Writer, queue string, long bool, list []string) error {
+	jobNumbers, usernames := splitList(list)
+
+	var state string
+	var err error
+	if long {
+		state, err = r.client().GetQueueStateLong(r.queue(queue), jobNumbers, usernames)
+	} else {
+		state, err = r.client().GetQueueStateShort(r.queue(queue), jobNumbers, usernames)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get state of upstream queue: %v", err)
+	}
+
+	_, err = io.WriteString(w, state)
+	return err
+}
+
+func (r *Relay) RemoveJobs(queue, agent string, list []string) error {
+	jobNumbers, usernames := splitList(list)
+
+	return r.client().RemoveJobs(r.queue(queue), agent, jobNumbers, usernames)
+}
+
+// splitList separates the job numbers from the user names of a command operand list
+func splitList(list []string) (jobNumbers, usernames []string) {
+	for _, item := range list {
+		if _, err := strconv.Atoi(item); err == nil {
+			jobNumbers = append(jobNumbers, item)
+		} else {
+			usernames = append(usernames, item)
+		}
+	}
+
+	return
+}
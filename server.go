@@ -0,0 +1,612 @@
+package lpd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to Shutdown or Close
+var ErrServerClosed = errors.New("lpd: server closed")
+
+// NegativeAcknowledge is sent by the server to reject a command, any other value than Acknowledge would do
+var NegativeAcknowledge byte = 0x1
+
+func NewServer(addr string) *Server {
+	return &Server{
+		Addr:      addr,
+		queues:    make(map[string]*Queue),
+		aliases:   make(map[string]string),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+		hosts:     make(map[string]int),
+		done:      make(chan struct{}),
+	}
+}
+
+// shutdownPollInterval is the interval in which Shutdown checks for finished connections
+const shutdownPollInterval = 50 * time.Millisecond
+
+type Server struct {
+	// Addr format is host:port
+	Addr string
+	// SpoolDir is the directory for received data files, defaults to os.TempDir(). If it is set, a job file is
+	// written next to the data files of every received job, the jobs left by a previous run are loaded again by
+	// the queues with the same name when they are added.
+	SpoolDir string
+	Limits   Limits
+	Timeouts Timeouts
+
+	mu     sync.Mutex
+	queues map[string]*Queue
+	// aliases maps the aliases of the queues to their names
+	aliases   map[string]string
+	listeners map[net.Listener]struct{}
+	conns     map[*serverConn]struct{}
+	// hosts counts the connections per remote address
+	hosts map[string]int
+	stats ConnStats
+	// done stops the queue workers
+	done    chan struct{}
+	stopped bool
+	closed  bool
+	workers sync.WaitGroup
+	// spooled is the size of all data files in the spool directory
+	spooled int64
+	// spool holds the jobs of a previous run by queue until the queue is added, it is nil until the spool
+	// directory was read
+	spool map[string][]*Job
+}
+
+// AddQueue registers the queue and starts delivering its jobs
+func (s *Server) AddQueue(q *Queue) {
+	q.init()
+
+	s.mu.Lock()
+	s.queues[q.Name] = q
+	s.addAliases(q)
+	s.recoverJobs(q)
+	s.mu.Unlock()
+
+	s.startWorker(q)
+}
+
+// ReplaceQueue registers the queue in place of the queue with the same name, e.g. to change its configuration.
+// The waiting jobs, including held jobs, and the enabled and printing state move to the new queue, the active
+// job is finished by the replaced queue. Jobs of connections which started before go to the new queue too.
+func (s *Server) ReplaceQueue(q *Queue) {
+	q.init()
+
+	s.mu.Lock()
+	if old, ok := s.queues[q.Name]; ok {
+		old.moveTo(q)
+		close(old.removed)
+		s.removeAliases(old)
+	}
+	s.queues[q.Name] = q
+	s.addAliases(q)
+	s.recoverJobs(q)
+	s.mu.Unlock()
+
+	s.startWorker(q)
+}
+
+// addJob queues a received job. A connection which started before its queue was replaced or removed still holds
+// the old queue, the job goes to the queue which took over the name or the worker of the removed queue is started
+// again, an acknowledged job is never dropped.
+func (s *Server) addJob(q *Queue, job *Job) {
+	for !q.add(job) {
+		s.mu.Lock()
+		current, ok := s.queues[q.Name]
+		if ok && current != q {
+			s.mu.Unlock()
+			q = current
+			continue
+		}
+
+		// the queue was removed and no queue took over its name
+		if q.restart(job) && !s.stopped {
+			s.startWorker(q)
+		}
+		s.mu.Unlock()
+		return
+	}
+}
+
+func (s *Server) startWorker(q *Queue) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		q.run(s.done)
+	}()
+}
+
+// RemoveQueue unregisters the queue, it does not accept new jobs but delivers the waiting ones and the jobs of
+// connections which started before. A new queue with the same name can be added right away, e.g. to change the
+// configuration of a queue.
+func (s *Server) RemoveQueue(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[name]
+	if !ok {
+		return
+	}
+
+	delete(s.queues, name)
+	s.removeAliases(q)
+	close(q.removed)
+}
+
+// addAliases registers the aliases of the queue, s.mu must be held
+func (s *Server) addAliases(q *Queue) {
+	for _, alias := range q.Aliases {
+		s.aliases[alias] = q.Name
+	}
+}
+
+// removeAliases unregisters the aliases of the queue which were not taken over by another queue, s.mu must be held
+func (s *Server) removeAliases(q *Queue) {
+	for _, alias := range q.Aliases {
+		if s.aliases[alias] == q.Name {
+			delete(s.aliases, alias)
+		}
+	}
+}
+
+// Queue returns the queue with the name or alias, a queue name takes precedence over an alias
+func (s *Server) Queue(name string) *Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[name]; ok {
+		return q
+	}
+
+	return s.queues[s.aliases[name]]
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	if !s.addListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.removeListener(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		c := newServerConn(conn, s.Timeouts)
+		if err := s.trackConn(c); err != nil {
+			conn.Close()
+			if err == ErrServerClosed {
+				return err
+			}
+			continue
+		}
+
+		go s.serveConn(c)
+	}
+}
+
+// Shutdown stops the server gracefully. It closes the listeners and waits until all connections are finished,
+// then the queue workers stop after their current delivery attempt, including the workers of replaced and removed
+// queues which still deliver a job. If the context expires first, the remaining connections are closed and their
+// incomplete jobs are removed, the context error is returned. Jobs which are not delivered, e.g. waiting, held or
+// retried jobs, are never removed, they stay in the spool directory and are loaded again on the next start if
+// SpoolDir is set.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	err := s.closeListeners()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for s.activeConns() > 0 {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.closeConns()
+			s.stopWorkers()
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	// a worker stops after its current attempt, the jobs it did not deliver stay in the spool directory
+	s.mu.Lock()
+	s.stopWorkers()
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// Close stops all listeners, connections and queue workers immediately, it does not wait for a delivery in
+// progress. Jobs which are not delivered yet stay in the spool directory. Use Shutdown to stop the server
+// gracefully.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.closeListeners()
+	s.closeConns()
+	s.stopWorkers()
+
+	return err
+}
+
+// addListener registers a listener, so it is closed by Shutdown and Close. It returns false if the server is closed.
+func (s *Server) addListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+
+	return true
+}
+
+func (s *Server) removeListener(l net.Listener) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	s.mu.Unlock()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// closeListeners must be called with the server lock held
+func (s *Server) closeListeners() error {
+	s.closed = true
+
+	var err error
+	for l := range s.listeners {
+		if inErr := l.Close(); inErr != nil {
+			err = inErr
+		}
+		delete(s.listeners, l)
+	}
+
+	return err
+}
+
+// closeConns must be called with the server lock held
+func (s *Server) closeConns() {
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// stopWorkers must be called with the server lock held
+func (s *Server) stopWorkers() {
+	if !s.stopped {
+		s.stopped = true
+		close(s.done)
+	}
+}
+
+// trackConn registers an accepted connection, it fails if the server is closed or a connection limit is reached
+func (s *Server) trackConn(conn *serverConn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.Limits.MaxConns > 0 && len(s.conns) >= s.Limits.MaxConns {
+		s.stats.DroppedMaxConns++
+		return errTooManyConns
+	}
+	if s.Limits.MaxConnsPerIP > 0 && s.hosts[conn.host] >= s.Limits.MaxConnsPerIP {
+		s.stats.DroppedPerIP++
+		return errTooManyConnsPerIP
+	}
+
+	s.conns[conn] = struct{}{}
+	s.hosts[conn.host]++
+	s.stats.Accepted++
+
+	return nil
+}
+
+func (s *Server) untrackConn(conn *serverConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+	if s.hosts[conn.host]--; s.hosts[conn.host] <= 0 {
+		delete(s.hosts, conn.host)
+	}
+	if conn.timedOut {
+		s.stats.DroppedTimeout++
+	}
+}
+
+func (s *Server) activeConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+func (s *Server) spoolDir() string {
+	if s.SpoolDir != "" {
+		return s.SpoolDir
+	}
+
+	return os.TempDir()
+}
+
+func (s *Server) serveConn(conn *serverConn) {
+	defer s.untrackConn(conn)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	cmd, err := conn.readDaemonCommand(r)
+	if err != nil {
+		if isCommandError(err) {
+			conn.Write([]byte{NegativeAcknowledge})
+		}
+		return
+	}
+
+	q := s.Queue(cmd.Queue)
+	if q == nil || !q.ACL.allowAddr(conn.RemoteAddr().String()) {
+		conn.Write([]byte{NegativeAcknowledge})
+		return
+	}
+
+	switch cmd.Command {
+	case PrintJobs:
+		q.wake()
+		conn.Write([]byte{Acknowledge})
+	case ReceiveJob:
+		if q.isDisabled() {
+			conn.Write([]byte{NegativeAcknowledge})
+			return
+		}
+		if _, err := conn.Write([]byte{Acknowledge}); err != nil {
+			return
+		}
+		s.receiveJob(conn, r, q)
+	case QueueStatsShort, QueueStatsLong:
+		long := cmd.Command == QueueStatsLong
+		if stater, ok := q.Backend.(QueueStater); ok {
+			stater.QueueState(conn, q.Name, long, cmd.List)
+			return
+		}
+		q.writeState(conn, long, cmd.List)
+	case RemoveJobs:
+		agent, list := cmd.Agent, cmd.List
+		if !q.ACL.allowUser(agent) {
+			conn.Write([]byte{NegativeAcknowledge})
+			return
+		}
+		q.remove(agent, list)
+		if remover, ok := q.Backend.(JobRemover); ok {
+			if err := remover.RemoveJobs(q.Name, agent, list); err != nil {
+				conn.Write([]byte{NegativeAcknowledge})
+				return
+			}
+		}
+		conn.Write([]byte{Acknowledge})
+	default:
+		conn.Write([]byte{NegativeAcknowledge})
+	}
+}
+
+// receiveJob handles the subcommands of a receive job command until the client closes the connection
+func (s *Server) receiveJob(conn *serverConn, r *bufio.Reader, q *Queue) {
+	job := s.newJob(conn, q)
+	defer func() {
+		if job != nil {
+			job.Remove()
+		}
+	}()
+
+	for {
+		cmd, err := conn.readSubCommand(r)
+		if err != nil {
+			// a job with a control file and at least one data file is taken, even if files are missing
+			if err == io.EOF && job.RawControlFile != nil && len(job.DataFiles) > 0 && s.reserveQuota(job, q) == nil &&
+				s.spoolJob(job) == nil {
+				s.addJob(q, job)
+				job = nil
+			}
+			if isCommandError(err) {
+				conn.Write([]byte{NegativeAcknowledge})
+			}
+			return
+		}
+
+		if cmd.Command == AbortJob {
+			job.Remove()
+			job = s.newJob(conn, q)
+			continue
+		}
+		count, name := cmd.Count, cmd.Name
+
+		if cmd.Command == SendControlFile {
+			err = s.Limits.checkControlFile(count)
+		} else {
+			err = s.Limits.checkDataFile(job, count)
+			if err == nil {
+				err = s.checkSpool(count)
+			}
+			if err == nil && q.Quota != nil {
+				err = q.Quota.checkJob(job, count)
+			}
+		}
+		if err != nil {
+			conn.Write([]byte{NegativeAcknowledge})
+			return
+		}
+
+		if _, err := conn.Write([]byte{Acknowledge}); err != nil {
+			return
+		}
+
+		if cmd.Command == SendControlFile {
+			err = receiveControlFile(conn.transferReader(r), job, name, count)
+			if err == nil && !q.ACL.allowUser(job.ControlFile[UserID]) {
+				err = ErrAccessDenied
+			}
+			if err == nil && q.Quota != nil {
+				// the user is known now, the data files received so far are checked against the user limits
+				err = q.Quota.checkJob(job, 0)
+			}
+		} else {
+			err = s.receiveDataFile(conn.transferReader(r), job, name, count)
+		}
+		if err == nil && job.complete() {
+			// the usage is reserved and the job file is written before the last file is acknowledged, a job which
+			// exceeds the quota is rejected
+			err = s.reserveQuota(job, q)
+			if err == nil {
+				err = s.spoolJob(job)
+			}
+		}
+		if err != nil {
+			conn.Write([]byte{NegativeAcknowledge})
+			return
+		}
+
+		_, err = conn.Write([]byte{Acknowledge})
+
+		if job.complete() {
+			s.addJob(q, job)
+			job = s.newJob(conn, q)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// reserveQuota reserves the usage of a received job in the quota of the queue
+func (s *Server) reserveQuota(job *Job, q *Queue) error {
+	if q.Quota == nil {
+		return nil
+	}
+
+	return q.Quota.reserve(job)
+}
+
+func (s *Server) newJob(conn net.Conn, q *Queue) *Job {
+	return &Job{
+		Queue:      q.Name,
+		RemoteAddr: conn.RemoteAddr().String(),
+		Received:   time.Now(),
+		release:    s.releaseSpool,
+	}
+}
+
+func receiveControlFile(r io.Reader, job *Job, name string, count int64) error {
+	data := make([]byte, count)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if err := readFileEnd(r); err != nil {
+		return err
+	}
+
+	cf := ControlFile{}
+	if len(data) > 0 {
+		var err error
+		if cf, err = NewControlFileDecoder(bytes.NewReader(data)).Decode(len(data)); err != nil {
+			return err
+		}
+	}
+
+	job.ControlFileName = name
+	job.Number = parseJobNumber(name)
+	job.ControlFile = cf
+	job.RawControlFile = data
+
+	return nil
+}
+
+func (s *Server) receiveDataFile(r io.Reader, job *Job, name string, count int64) error {
+	f, err := ioutil.TempFile(s.spoolDir(), "lpd-df")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := &spoolWriter{w: f, server: s, job: job, limit: s.Limits.dataFileLimit(job)}
+
+	// add the file before writing it, so it gets removed with the job on errors
+	df := &DataFile{Name: name, Size: count, Path: f.Name()}
+	job.DataFiles = append(job.DataFiles, df)
+
+	// a count of zero is an empty file, it is terminated by the zero octet like every other file
+	if _, err := io.CopyN(w, r, count); err != nil {
+		return err
+	}
+
+	return readFileEnd(r)
+}
+
+// readFileEnd reads the octet of zero bits which terminates a transferred file
+func readFileEnd(r io.Reader) error {
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+
+	if buf[0] != 0 {
+		return fmt.Errorf("file is not terminated by a zero octet, got %#x", buf[0])
+	}
+
+	return nil
+}
+
+// isCommandError reports whether a command line was rejected by the parser, the client gets a negative acknowledgement
+func isCommandError(err error) bool {
+	return errors.Is(err, ErrMalformedCommand) || err == ErrLineTooLong
+}
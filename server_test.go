@@ -0,0 +1,715 @@
+package lpd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type receivedJob struct {
+	Job  *Job
+	Data []byte
+}
+
+type recordingBackend struct {
+	jobs  chan receivedJob
+	fails int
+}
+
+func newRecordingBackend() *recordingBackend {
+	return &recordingBackend{jobs: make(chan receivedJob, 10)}
+}
+
+func (b *recordingBackend) Deliver(job *Job) error {
+	if b.fails > 0 {
+		b.fails--
+		return errors.New("backend not available")
+	}
+
+	var data []byte
+	for _, df := range job.DataFiles {
+		content, err := ioutil.ReadFile(df.Path)
+		if err != nil {
+			return err
+		}
+		data = append(data, content...)
+	}
+
+	b.jobs <- receivedJob{Job: job, Data: data}
+	return nil
+}
+
+func (b *recordingBackend) next(t *testing.T) receivedJob {
+	t.Helper()
+
+	select {
+	case job := <-b.jobs:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job delivered")
+	}
+
+	return receivedJob{}
+}
+
+func startTestServer(t *testing.T, queues ...*Queue) (*Server, *Client) {
+	t.Helper()
+
+	return startConfiguredTestServer(t, func(*Server) {}, queues...)
+}
+
+// startConfiguredTestServer calls configure before the server starts serving
+func startConfiguredTestServer(t *testing.T, configure func(s *Server), queues ...*Queue) (*Server, *Client) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	s := NewServer(l.Addr().String())
+	s.SpoolDir = t.TempDir()
+	for _, q := range queues {
+		s.AddQueue(q)
+	}
+	configure(s)
+
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	return s, NewClient(addr.IP.String(), addr.Port)
+}
+
+func TestServerReceiveJob(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("hello world"),
+		Size:     11,
+		Name:     "hello.txt",
+	}, "lp", ControlFile{JobName: "greeting"}, PrintWithLeavingControlCharacters)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	received := backend.next(t)
+
+	if !bytes.Equal(received.Data, []byte("hello world")) {
+		t.Errorf("data file is not correct, expected %q, got %q", "hello world", received.Data)
+	}
+	if received.Job.ControlFile[JobName] != "greeting" {
+		t.Errorf("job name is not correct, expected %q, got %q", "greeting", received.Job.ControlFile[JobName])
+	}
+
+	lines := received.Job.PrintLines()
+	if len(lines) != 1 || lines[0].Format != PrintWithLeavingControlCharacters {
+		t.Errorf("print lines are not correct, got %v", lines)
+	}
+}
+
+func TestServerEmptyDataFile(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	// an empty file is announced with a count of zero and terminated by the zero octet
+	printed := make(chan error, 1)
+	go func() {
+		printed <- client.PrintDocument(Document{Document: strings.NewReader(""), Name: "empty.txt"}, "lp", nil, PlainTextFile)
+	}()
+
+	select {
+	case err := <-printed:
+		if err != nil {
+			t.Fatalf("error while printing document: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("printing an empty document did not finish")
+	}
+
+	if received := backend.next(t); len(received.Job.DataFiles) != 1 || len(received.Data) != 0 {
+		t.Errorf("empty data file is not correct, got %+v", received.Job.DataFiles)
+	}
+}
+
+func TestServerUnknownQueue(t *testing.T) {
+	_, client := startTestServer(t)
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "unknown", nil, PlainTextFile)
+	if err == nil {
+		t.Error("expected an error when printing to an unknown queue")
+	}
+}
+
+func TestServerOversizedControlFile(t *testing.T) {
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn, err := net.Dial("tcp", client.dest)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := SendCommandLine(conn, byte(ReceiveJob), []string{"lp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("receive job was not acknowledged: %v", err)
+	}
+
+	if err := SendCommandLine(conn, byte(SendControlFile), []string{"999999999999999", "cfA001host"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckAcknowledge(conn); err == nil {
+		t.Error("oversized control file was acknowledged")
+	}
+}
+
+func TestServerQueueState(t *testing.T) {
+	// the backend blocks delivery, so the job stays in the queue
+	backend := newRecordingBackend()
+	backend.fails = 1000
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend, RetryInterval: time.Hour})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", ControlFile{UserID: "alice"}, PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	state, err := client.GetQueueStateShort("lp", nil, nil)
+	if err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+
+	if !strings.Contains(state, "active") || !strings.Contains(state, "alice") {
+		t.Errorf("queue state does not contain the job, got %q", state)
+	}
+
+	if err := client.RemoveJobs("lp", "alice", nil, nil); err != nil {
+		t.Fatalf("error while removing jobs: %v", err)
+	}
+
+	state, err = client.GetQueueStateShort("lp", nil, nil)
+	if err != nil {
+		t.Fatalf("error while getting queue state: %v", err)
+	}
+
+	if !strings.Contains(state, "no entries") {
+		t.Errorf("queue state contains removed job, got %q", state)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	upstream := newRecordingBackend()
+	_, upstreamClient := startTestServer(t, &Queue{Name: "remote", Backend: upstream})
+
+	relay := &Relay{
+		Client:   upstreamClient,
+		Queue:    "remote",
+		Hostname: "relayhost",
+		UserID:   "relay",
+	}
+	// the first attempt fails, the job has to be kept until the upstream is available
+	_, client := startTestServer(t, &Queue{Name: "local", Backend: &failingBackend{Backend: relay, fails: 1}, RetryInterval: 10 * time.Millisecond})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("relayed"),
+		Size:     7,
+		Name:     "relayed.txt",
+	}, "local", ControlFile{JobName: "relayed job"}, PostscriptFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	received := upstream.next(t)
+
+	if !bytes.Equal(received.Data, []byte("relayed")) {
+		t.Errorf("data file is not correct, expected %q, got %q", "relayed", received.Data)
+	}
+	if received.Job.Queue != "remote" {
+		t.Errorf("queue is not correct, expected %q, got %q", "remote", received.Job.Queue)
+	}
+
+	// the banner page is printed for the rewritten user
+	for cmd, value := range map[ControlFileCommand]string{Hostname: "relayhost", UserID: "relay", PrintBanner: "relay", JobName: "relayed job"} {
+		if received.Job.ControlFile[cmd] != value {
+			t.Errorf("control file command %c is not correct, expected %q, got %q", cmd, value, received.Job.ControlFile[cmd])
+		}
+	}
+
+	lines := received.Job.PrintLines()
+	if len(lines) != 1 || lines[0].Format != PostscriptFile {
+		t.Errorf("print lines are not correct, got %v", lines)
+	}
+}
+
+func TestRelayRetry(t *testing.T) {
+	upstream := newRecordingBackend()
+	_, upstreamClient := startTestServer(t, &Queue{Name: "remote", Backend: upstream})
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "dfA001host"), filepath.Join(dir, "dfB001host")
+	if err := ioutil.WriteFile(first, []byte("first"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+
+	// the second data file is missing, so the first attempt fails after the first print line
+	job := &Job{
+		ControlFile:    ControlFile{UserID: "alice"},
+		RawControlFile: []byte("Halice\nfdfA001host\nfdfB001host\n"),
+		DataFiles:      []*DataFile{{Name: "dfA001host", Size: 5, Path: first}, {Name: "dfB001host", Size: 6, Path: second}},
+	}
+
+	relay := &Relay{Client: upstreamClient, Queue: "remote"}
+	if err := relay.Deliver(job); err == nil {
+		t.Fatal("expected an error for the missing data file")
+	}
+	if received := upstream.next(t); string(received.Data) != "first" {
+		t.Errorf("first print line is not correct, got %q", received.Data)
+	}
+
+	if err := ioutil.WriteFile(second, []byte("second"), 0600); err != nil {
+		t.Fatalf("could not write data file: %v", err)
+	}
+	if err := relay.Deliver(job); err != nil {
+		t.Fatalf("error while retrying job: %v", err)
+	}
+
+	// the retry sends only the print line which failed
+	if received := upstream.next(t); string(received.Data) != "second" {
+		t.Errorf("retried print line is not correct, got %q", received.Data)
+	}
+	select {
+	case received := <-upstream.jobs:
+		t.Errorf("print line was sent twice, got %q", received.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRelayNoBanner(t *testing.T) {
+	upstream := newRecordingBackend()
+	_, upstreamClient := startTestServer(t, &Queue{Name: "remote", Backend: upstream})
+	_, client := startTestServer(t, &Queue{Name: "local", Backend: &Relay{Client: upstreamClient, Queue: "remote"}})
+
+	err := client.PrintDocumentWithOptions(Document{
+		Document: strings.NewReader("relayed"),
+		Size:     7,
+		Name:     "relayed.txt",
+	}, "local", ControlFile{}, PlainTextFile, PrintOptions{NoBanner: true})
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	// the relay must not request a banner page the job did not ask for
+	if banner, ok := upstream.next(t).Job.ControlFile[PrintBanner]; ok {
+		t.Errorf("forwarded job requests a banner page for %q", banner)
+	}
+}
+
+func TestRelayTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+
+	// the upstream server accepts the connection but never answers
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(5 * time.Second)
+	}()
+
+	relay := &Relay{Client: &Client{dest: l.Addr().String()}, Timeout: 50 * time.Millisecond}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- relay.Deliver(newTestJob(t, "data"))
+	}()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("expected an error for the stalled upstream server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay is blocked by the stalled upstream server")
+	}
+}
+
+type failingBackend struct {
+	Backend
+	fails int
+}
+
+func (b *failingBackend) Deliver(job *Job) error {
+	if b.fails > 0 {
+		b.fails--
+		return errors.New("upstream not available")
+	}
+
+	return b.Backend.Deliver(job)
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	// start a job transfer which is in flight while the server shuts down
+	conn := startRawReceiveJob(t, client)
+	if err := SendCommandLine(conn, byte(SendDataFile), []string{"4", "dfA001host"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("data file command was not acknowledged: %v", err)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	// new connections are refused once the listener is closed
+	for i := 0; ; i++ {
+		c, err := net.Dial("tcp", client.dest)
+		if err != nil {
+			break
+		}
+		c.Close()
+		if i == 100 {
+			t.Fatal("server still accepts connections")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the transfer is finished
+	conn.Write([]byte("data\x00"))
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Errorf("data file was not acknowledged during shutdown: %v", err)
+	}
+	conn.Close()
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("error while shutting down: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+}
+
+func TestServerShutdownKeepsJobs(t *testing.T) {
+	stopped := &Queue{Name: "stopped", Backend: newRecordingBackend()}
+	stopped.Stop()
+	s, client := startTestServer(t, &Queue{
+		Name:    "lp",
+		Backend: &failingBackend{Backend: newRecordingBackend(), fails: 1},
+		// the job is retried until it is delivered, the shutdown must not wait for it
+		RetryInterval: time.Hour,
+	}, stopped)
+
+	for _, queue := range []string{"lp", "stopped"} {
+		err := client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, queue, ControlFile{UserID: "alice"}, PlainTextFile)
+		if err != nil {
+			t.Fatalf("error while printing to %s: %v", queue, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	// the retried job and the job of the stopped queue stay in the spool directory
+	files, err := ioutil.ReadDir(s.SpoolDir)
+	if err != nil {
+		t.Fatalf("error while reading the spool directory: %v", err)
+	}
+	if len(files) != 4 {
+		t.Errorf("expected the job and data files of both jobs in the spool directory, got %d files", len(files))
+	}
+}
+
+// blockingBackend blocks a delivery until unblock is closed
+type blockingBackend struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingBackend) Deliver(job *Job) error {
+	b.started <- struct{}{}
+	<-b.unblock
+	return nil
+}
+
+func TestServerShutdownReplacedQueue(t *testing.T) {
+	backend := &blockingBackend{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+	s, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", nil, PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	select {
+	case <-backend.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not start")
+	}
+
+	// the replaced queue still delivers its active job
+	s.ReplaceQueue(&Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned during the delivery of the replaced queue: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(backend.unblock)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("error while shutting down: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return")
+	}
+
+	// the delivered job was removed before the shutdown returned
+	if files, _ := ioutil.ReadDir(s.SpoolDir); len(files) != 0 {
+		t.Errorf("spool directory still contains %d files", len(files))
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	s, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn := startRawReceiveJob(t, client)
+	if err := SendCommandLine(conn, byte(SendDataFile), []string{"4", "dfA001host"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("data file command was not acknowledged: %v", err)
+	}
+	// the transfer stalls after the first bytes
+	conn.Write([]byte("da"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+
+	// the incomplete job is removed after the connection was closed
+	for i := 0; ; i++ {
+		files, _ := ioutil.ReadDir(s.SpoolDir)
+		if len(files) == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("incomplete job was not removed, spool contains %d files", len(files))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerRemoveQueue(t *testing.T) {
+	old := newRecordingBackend()
+	old.fails = 1
+	s, client := startTestServer(t, &Queue{Name: "lp", Backend: old, RetryInterval: 50 * time.Millisecond})
+
+	printDocument := func() error {
+		return client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, "lp", nil, PlainTextFile)
+	}
+
+	if err := printDocument(); err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	// the queue is replaced while its job waits for the next attempt
+	current := newRecordingBackend()
+	s.RemoveQueue("lp")
+	s.AddQueue(&Queue{Name: "lp", Backend: current})
+
+	if err := printDocument(); err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	old.next(t)
+	current.next(t)
+}
+
+func TestServerReplaceQueue(t *testing.T) {
+	old := &Queue{Name: "lp", Backend: newRecordingBackend()}
+	s, client := startTestServer(t, old)
+
+	printDocument := func(user string) error {
+		return client.PrintDocument(Document{
+			Document: strings.NewReader("data"),
+			Size:     4,
+			Name:     "data.txt",
+		}, "lp", ControlFile{UserID: user}, PlainTextFile)
+	}
+
+	// a held job of a stopped and disabled queue
+	old.Stop()
+	if err := printDocument("alice"); err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+	if err := old.Hold("alice"); err != nil {
+		t.Fatalf("error while holding the job: %v", err)
+	}
+	old.Disable()
+
+	current := newRecordingBackend()
+	replacement := &Queue{Name: "lp", Backend: current}
+	s.ReplaceQueue(replacement)
+
+	if len(old.Jobs()) != 0 {
+		t.Errorf("replaced queue still has %d jobs", len(old.Jobs()))
+	}
+	if status := replacement.Status(); status.Queuing || status.Printing || status.Jobs != 1 || status.Held != 1 {
+		t.Errorf("jobs and state were not moved to the new queue, got %+v", status)
+	}
+
+	replacement.Enable()
+	replacement.Start()
+	if err := replacement.Release("alice"); err != nil {
+		t.Fatalf("error while releasing the job: %v", err)
+	}
+
+	if job := current.next(t); job.Job.ControlFile[UserID] != "alice" {
+		t.Errorf("unexpected job delivered: %+v", job.Job)
+	}
+}
+
+func TestServerQueueAlias(t *testing.T) {
+	backend := newRecordingBackend()
+	s, client := startTestServer(t, &Queue{Name: "lp", Aliases: []string{"local"}, Backend: backend})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "local", nil, PlainTextFile)
+	if err != nil {
+		t.Fatalf("error while printing to the alias: %v", err)
+	}
+
+	if job := backend.next(t); job.Job.Queue != "lp" {
+		t.Errorf("job of the alias is not in the queue, got queue %q", job.Job.Queue)
+	}
+
+	// the aliases are taken from the replacement
+	s.ReplaceQueue(&Queue{Name: "lp", Aliases: []string{"laser"}, Backend: backend})
+	if s.Queue("local") != nil || s.Queue("laser") == nil {
+		t.Error("aliases of the replaced queue are not correct")
+	}
+
+	s.RemoveQueue("lp")
+	if s.Queue("laser") != nil {
+		t.Error("alias of the removed queue is still registered")
+	}
+}
+
+func TestServerLateJob(t *testing.T) {
+	for _, replace := range []bool{true, false} {
+		old := &Queue{Name: "lp", Backend: newRecordingBackend()}
+		s, client := startTestServer(t, old)
+
+		session, err := client.Dial()
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		defer session.Close()
+
+		// the connection holds the old queue, the job arrives after its worker stopped
+		if err := session.ReceiveJob("lp"); err != nil {
+			t.Fatalf("receive job was not acknowledged: %v", err)
+		}
+
+		current := newRecordingBackend()
+		if replace {
+			s.ReplaceQueue(&Queue{Name: "lp", Backend: current})
+		} else {
+			s.RemoveQueue("lp")
+		}
+		waitStopped(t, old)
+
+		controlFile := ControlFile{Hostname: "host", UserID: "alice", ControlFileCommand(PlainTextFile): "dfA001host"}
+		cf, err := controlFile.Encode()
+		if err != nil {
+			t.Fatalf("could not encode control file: %v", err)
+		}
+		if err := session.SendControlFile("cfA001host", cf); err != nil {
+			t.Fatalf("control file was not acknowledged: %v", err)
+		}
+		if err := session.SendDataFile("dfA001host", 4, strings.NewReader("late")); err != nil {
+			t.Fatalf("data file was not acknowledged: %v", err)
+		}
+
+		// the acknowledged job goes to the replacement, or the removed queue delivers it
+		backend := old.Backend.(*recordingBackend)
+		if replace {
+			backend = current
+		}
+		if received := backend.next(t); string(received.Data) != "late" {
+			t.Errorf("late job is not correct, got %q", received.Data)
+		}
+	}
+}
+
+func waitStopped(t *testing.T, q *Queue) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		q.mu.Lock()
+		stopped := q.stopped
+		q.mu.Unlock()
+
+		if stopped {
+			return
+		}
+	}
+
+	t.Fatalf("worker of queue %s did not stop", q.Name)
+}
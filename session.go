@@ -0,0 +1,160 @@
+package lpd
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Session runs the steps of the lpd protocol one by one over a connection. The client methods open a connection
+// for every request and always send the steps in the same order, a session lets the caller choose them, e.g. to send
+// the data files before the control file, to send several jobs over one connection or to test a server.
+//
+// A session is not safe for concurrent use.
+type Session struct {
+	rw io.ReadWriter
+}
+
+// NewSession returns a session over a connection to an lpd server
+func NewSession(rw io.ReadWriter) *Session {
+	return &Session{rw: rw}
+}
+
+// Dial opens a connection to the server of the client and returns a session over it, the session has to be closed
+func (c *Client) Dial() (*Session, error) {
+	if c.Timeout <= 0 {
+		conn, err := net.Dial("tcp", c.dest)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSession(conn), nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.dest, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSession(&timeoutConn{Conn: conn, timeout: c.Timeout}), nil
+}
+
+// timeoutConn sets the deadline of the connection before every read and write
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+// Close closes the connection of the session if it implements io.Closer
+func (s *Session) Close() error {
+	if closer, ok := s.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// SendCommand sends a daemon command or sub command line without waiting for the acknowledgement
+func (s *Session) SendCommand(cmd byte, operands ...string) error {
+	return SendCommandLine(s.rw, cmd, operands)
+}
+
+// CheckAcknowledge reads the answer of the server and returns an error if it is not an acknowledgement
+func (s *Session) CheckAcknowledge() error {
+	return CheckAcknowledge(s.rw)
+}
+
+// command sends a command line and waits for the acknowledgement
+func (s *Session) command(cmd byte, operands ...string) error {
+	if err := s.SendCommand(cmd, operands...); err != nil {
+		return err
+	}
+
+	return s.CheckAcknowledge()
+}
+
+// PrintJobs asks the server to start printing the waiting jobs of a queue
+func (s *Session) PrintJobs(queue string) error {
+	return s.command(byte(PrintJobs), queue)
+}
+
+// ReceiveJob starts the transfer of jobs to a queue, it is followed by SendControlFile, SendDataFile and Abort
+func (s *Session) ReceiveJob(queue string) error {
+	return s.command(byte(ReceiveJob), queue)
+}
+
+// SendControlFile sends an encoded control file, see ControlFile.Encode. The name starts with cfA, followed by the
+// job number and the host name.
+func (s *Session) SendControlFile(name string, cf []byte) error {
+	if err := s.command(byte(SendControlFile), strconv.Itoa(len(cf)), name); err != nil {
+		return err
+	}
+
+	if _, err := s.rw.Write(cf); err != nil {
+		return err
+	}
+
+	return s.sendFileEnd()
+}
+
+// SendDataFile sends a data file of size bytes. The content of r is sent as it is, so a size which does not match
+// the content can be announced. The name starts with dfA, followed by the job number and the host name.
+func (s *Session) SendDataFile(name string, size int64, r io.Reader) error {
+	if err := s.command(byte(SendDataFile), strconv.FormatInt(size, 10), name); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(s.rw, r); err != nil {
+		return err
+	}
+
+	return s.sendFileEnd()
+}
+
+// sendFileEnd terminates a transferred file with a zero octet and waits for the acknowledgement
+func (s *Session) sendFileEnd() error {
+	if _, err := s.rw.Write([]byte{0}); err != nil {
+		return err
+	}
+
+	return s.CheckAcknowledge()
+}
+
+// Abort tells the server to discard the files of the current job, the server does not answer
+func (s *Session) Abort() error {
+	return s.SendCommand(byte(AbortJob))
+}
+
+// QueueState requests the short or long state of a queue, the list holds job numbers and user names. The server
+// closes the connection after the answer, the session can not be used any further.
+func (s *Session) QueueState(queue string, long bool, list []string) (string, error) {
+	cmd := QueueStatsShort
+	if long {
+		cmd = QueueStatsLong
+	}
+
+	if err := s.SendCommand(byte(cmd), append([]string{queue}, list...)...); err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadAll(s.rw)
+	return string(data), err
+}
+
+// RemoveJobs requests the removal of jobs, the list holds job numbers and user names. The agent is the user name
+// making the request.
+func (s *Session) RemoveJobs(queue, agent string, list []string) error {
+	return s.command(byte(RemoveJobs), append([]string{queue, agent}, list...)...)
+}
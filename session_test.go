@@ -0,0 +1,94 @@
+package lpd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSessionDataFileFirst(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	session, err := client.Dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer session.Close()
+
+	controlFile := ControlFile{Hostname: "host", UserID: "alice", ControlFileCommand(PlainTextFile): "dfA001host"}
+	cf, err := controlFile.Encode()
+	if err != nil {
+		t.Fatalf("could not encode control file: %v", err)
+	}
+
+	if err := session.ReceiveJob("lp"); err != nil {
+		t.Fatalf("receive job was not acknowledged: %v", err)
+	}
+
+	// the first job is aborted after its data file
+	if err := session.SendDataFile("dfA000host", 7, strings.NewReader("aborted")); err != nil {
+		t.Fatalf("data file was not acknowledged: %v", err)
+	}
+	if err := session.Abort(); err != nil {
+		t.Fatalf("could not abort: %v", err)
+	}
+
+	if err := session.SendDataFile("dfA001host", 5, strings.NewReader("hello")); err != nil {
+		t.Fatalf("data file was not acknowledged: %v", err)
+	}
+	if err := session.SendControlFile("cfA001host", cf); err != nil {
+		t.Fatalf("control file was not acknowledged: %v", err)
+	}
+
+	received := backend.next(t)
+	if string(received.Data) != "hello" || received.Job.ControlFile[UserID] != "alice" {
+		t.Errorf("job is not correct, got %q from %q", received.Data, received.Job.ControlFile[UserID])
+	}
+}
+
+func TestSessionNegativeAcknowledge(t *testing.T) {
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	session, err := client.Dial()
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.ReceiveJob("unknown"); err == nil {
+		t.Error("receive job for an unknown queue was acknowledged")
+	}
+}
+
+func TestSessionWire(t *testing.T) {
+	written := new(bytes.Buffer)
+	session := NewSession(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("\x00\x00\x00\x00"), written})
+
+	if err := session.ReceiveJob("lp"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := session.SendControlFile("cfA001host", []byte("Halice\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := session.Abort(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := session.RemoveJobs("lp", "alice", []string{"1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "\x02lp\n\x027 cfA001host\nHalice\n\x00\x01\n\x05lp alice 1\n"
+	if written.String() != expected {
+		t.Errorf("expected %q, got %q", expected, written.String())
+	}
+
+	// there are no answers left
+	if err := session.PrintJobs("lp"); err == nil {
+		t.Error("missing answer was not reported")
+	}
+}
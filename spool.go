@@ -0,0 +1,188 @@
+package lpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spoolJobPrefix starts the names of the job files in the spool directory, the data files start with lpd-df
+const spoolJobPrefix = "lpd-cf"
+
+// spooledJob is the job file which keeps a received job next to its data files, so the job is loaded again after
+// a restart of the server
+type spooledJob struct {
+	Queue           string            `json:"queue"`
+	ControlFileName string            `json:"control_file_name"`
+	ControlFile     []byte            `json:"control_file"`
+	DataFiles       []spooledDataFile `json:"data_files"`
+	RemoteAddr      string            `json:"remote_addr"`
+	Received        time.Time         `json:"received"`
+	Held            bool              `json:"held"`
+}
+
+type spooledDataFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// File is the name of the file in the spool directory
+	File string `json:"file"`
+}
+
+// spoolJob writes the job file of a received job, jobs are only kept across restarts if SpoolDir is set
+func (s *Server) spoolJob(job *Job) error {
+	if s.SpoolDir == "" {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(s.SpoolDir, spoolJobPrefix)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	job.spoolFile = f.Name()
+	if err := job.save(); err != nil {
+		os.Remove(job.spoolFile)
+		job.spoolFile = ""
+		return err
+	}
+
+	return nil
+}
+
+// save replaces the job file of the job, e.g. after the job was held
+func (j *Job) save() error {
+	if j.spoolFile == "" {
+		return nil
+	}
+
+	spooled := spooledJob{
+		Queue:           j.Queue,
+		ControlFileName: j.ControlFileName,
+		ControlFile:     j.RawControlFile,
+		RemoteAddr:      j.RemoteAddr,
+		Received:        j.Received,
+		Held:            j.held,
+	}
+	for _, df := range j.DataFiles {
+		spooled.DataFiles = append(spooled.DataFiles, spooledDataFile{Name: df.Name, Size: df.Size, File: filepath.Base(df.Path)})
+	}
+
+	data, err := json.Marshal(spooled)
+	if err != nil {
+		return err
+	}
+
+	// replace the file at once, so a crash does not leave a partial file
+	if err := writeFile(j.spoolFile+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(j.spoolFile+".tmp", j.spoolFile)
+}
+
+// recoverJobs adds the jobs of the queue which were left in the spool directory by a previous run, the spool
+// directory is read when the first queue is added. s.mu must be held.
+func (s *Server) recoverJobs(q *Queue) {
+	if s.SpoolDir == "" {
+		return
+	}
+
+	if s.spool == nil {
+		s.spool = make(map[string][]*Job)
+		s.loadSpool(q)
+	}
+
+	jobs := s.spool[q.Name]
+	delete(s.spool, q.Name)
+
+	for _, job := range jobs {
+		job.spooled = job.Size()
+		job.release = s.releaseSpool
+		s.spooled += job.spooled
+
+		if q.Quota != nil {
+			// the job was accepted before the restart, it is delivered even if it does not fit into the quota now
+			q.Quota.reserve(job)
+		}
+	}
+
+	q.mu.Lock()
+	q.jobs = append(q.jobs, jobs...)
+	q.mu.Unlock()
+}
+
+// loadSpool reads the job files of the spool directory, errors are logged by the queue
+func (s *Server) loadSpool(q *Queue) {
+	files, err := ioutil.ReadDir(s.SpoolDir)
+	if err != nil {
+		q.logf("lpd: could not read spool directory %s: %v", s.SpoolDir, err)
+		return
+	}
+
+	var jobs []*Job
+	for _, fi := range files {
+		if !strings.HasPrefix(fi.Name(), spoolJobPrefix) || strings.HasSuffix(fi.Name(), ".tmp") {
+			continue
+		}
+
+		job, err := s.loadJob(filepath.Join(s.SpoolDir, fi.Name()))
+		if err != nil {
+			q.logf("lpd: could not load spooled job %s: %v", fi.Name(), err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	// the jobs keep the order in which they were received
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Received.Before(jobs[j].Received) })
+	for _, job := range jobs {
+		s.spool[job.Queue] = append(s.spool[job.Queue], job)
+	}
+}
+
+func (s *Server) loadJob(path string) (*Job, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spooled spooledJob
+	if err := json.Unmarshal(data, &spooled); err != nil {
+		return nil, err
+	}
+
+	cf := ControlFile{}
+	if len(spooled.ControlFile) > 0 {
+		if cf, err = NewControlFileDecoder(bytes.NewReader(spooled.ControlFile)).Decode(len(spooled.ControlFile)); err != nil {
+			return nil, err
+		}
+	}
+
+	job := &Job{
+		Number:          parseJobNumber(spooled.ControlFileName),
+		Queue:           spooled.Queue,
+		ControlFileName: spooled.ControlFileName,
+		ControlFile:     cf,
+		RawControlFile:  spooled.ControlFile,
+		RemoteAddr:      spooled.RemoteAddr,
+		Received:        spooled.Received,
+		held:            spooled.Held,
+		spoolFile:       path,
+	}
+	for _, df := range spooled.DataFiles {
+		job.DataFiles = append(job.DataFiles, &DataFile{
+			Name: df.Name,
+			Size: df.Size,
+			// the base name keeps the files of a job inside the spool directory
+			Path: filepath.Join(s.SpoolDir, filepath.Base(df.File)),
+		})
+	}
+
+	return job, nil
+}
@@ -0,0 +1,97 @@
+package lpd
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSpoolTestServer starts a server with the spool directory, so a test can restart it
+func startSpoolTestServer(t *testing.T, dir string, queues ...*Queue) (*Server, *Client) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	s := NewServer(l.Addr().String())
+	s.SpoolDir = dir
+	for _, q := range queues {
+		s.AddQueue(q)
+	}
+
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	return s, NewClient(addr.IP.String(), addr.Port)
+}
+
+func TestServerSpoolRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	stopped := &Queue{Name: "lp", Backend: newRecordingBackend()}
+	stopped.Stop()
+	other := &Queue{Name: "other", Backend: newRecordingBackend()}
+	other.Stop()
+	s, client := startSpoolTestServer(t, dir, stopped, other)
+
+	for _, job := range []struct{ queue, user string }{{"lp", "alice"}, {"lp", "bob"}, {"other", "carol"}} {
+		err := client.PrintDocument(Document{
+			Document: strings.NewReader("data of " + job.user),
+			Size:     len("data of " + job.user),
+			Name:     "data.txt",
+		}, job.queue, ControlFile{UserID: job.user}, PlainTextFile)
+		if err != nil {
+			t.Fatalf("error while printing to %s: %v", job.queue, err)
+		}
+	}
+	if err := stopped.Hold("bob"); err != nil {
+		t.Fatalf("error while holding the job: %v", err)
+	}
+	s.Close()
+
+	// the restarted server delivers the jobs of the previous run, the held job stays held
+	backend := newRecordingBackend()
+	restarted := &Queue{Name: "lp", Backend: backend}
+	s, _ = startSpoolTestServer(t, dir, restarted)
+
+	received := backend.next(t)
+	if string(received.Data) != "data of alice" || received.Job.ControlFile[UserID] != "alice" {
+		t.Errorf("recovered job is not correct, got %q from %q", received.Data, received.Job.ControlFile[UserID])
+	}
+	if status := restarted.Status(); status.Jobs != 1 || status.Held != 1 {
+		t.Errorf("held job was not recovered, got %+v", status)
+	}
+
+	if err := restarted.Release("bob"); err != nil {
+		t.Fatalf("error while releasing the job: %v", err)
+	}
+	if received := backend.next(t); string(received.Data) != "data of bob" {
+		t.Errorf("released job is not correct, got %q", received.Data)
+	}
+
+	// the job of a queue which is added later waits in the spool directory until then
+	late := newRecordingBackend()
+	s.AddQueue(&Queue{Name: "other", Backend: late})
+	if received := late.next(t); string(received.Data) != "data of carol" {
+		t.Errorf("job of the later queue is not correct, got %q", received.Data)
+	}
+
+	// the delivered jobs are removed from the spool directory
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("error while reading the spool directory: %v", err)
+		}
+		if len(files) == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("spool directory still contains %d files", len(files))
+		}
+	}
+}
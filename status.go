@@ -0,0 +1,118 @@
+package lpd
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QueueState is the parsed answer of a queue state command in the bsd lpq format
+type QueueState struct {
+	// Status holds the lines before the job list, like "lp is ready and printing"
+	Status []string     `json:"status"`
+	Jobs   []QueueEntry `json:"jobs"`
+}
+
+// QueueEntry is a job listed in the queue state
+type QueueEntry struct {
+	Rank   string `json:"rank"`
+	Owner  string `json:"owner"`
+	Number int    `json:"number"`
+	// Host is only listed in the long format
+	Host string `json:"host,omitempty"`
+	// Name is the job name or the list of files in the short format
+	Name string `json:"name,omitempty"`
+	// Files are only listed in the long format
+	Files []QueueFile `json:"files,omitempty"`
+	Size  int64       `json:"size"`
+}
+
+type QueueFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+var longEntryHeader = regexp.MustCompile(`^(\S*): (\S+)\s+\[job (\d{3})(.*)\]$`)
+
+// ParseQueueState parses the answer of a short or long queue state command
+func ParseQueueState(state string, long bool) (*QueueState, error) {
+	qs := &QueueState{}
+	var entry *QueueEntry
+	header := false
+
+	scanner := bufio.NewScanner(strings.NewReader(state))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+
+		switch {
+		case line == "" || line == "no entries":
+		case !long && strings.HasPrefix(line, "Rank") && strings.HasSuffix(line, "Total Size"):
+			header = true
+		case !long && header:
+			e, err := parseShortEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			qs.Jobs = append(qs.Jobs, e)
+		case long && longEntryHeader.MatchString(line):
+			m := longEntryHeader.FindStringSubmatch(line)
+			number, _ := strconv.Atoi(m[3])
+			qs.Jobs = append(qs.Jobs, QueueEntry{Owner: m[1], Rank: m[2], Number: number, Host: m[4]})
+			entry = &qs.Jobs[len(qs.Jobs)-1]
+		case long && entry != nil && strings.HasPrefix(line, "\t"):
+			name, size, err := parseSize(strings.TrimSpace(line))
+			if err != nil {
+				return nil, err
+			}
+			entry.Files = append(entry.Files, QueueFile{Name: name, Size: size})
+			entry.Size += size
+		default:
+			qs.Status = append(qs.Status, line)
+		}
+	}
+
+	return qs, scanner.Err()
+}
+
+// parseShortEntry parses a line like "1st    alice      7    report                                12 bytes"
+func parseShortEntry(line string) (QueueEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return QueueEntry{}, fmt.Errorf("invalid queue entry %q", line)
+	}
+
+	number, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return QueueEntry{}, fmt.Errorf("invalid job number in queue entry %q", line)
+	}
+
+	_, size, err := parseSize(strings.Join(fields[3:], " "))
+	if err != nil {
+		return QueueEntry{}, err
+	}
+
+	return QueueEntry{
+		Rank:   fields[0],
+		Owner:  fields[1],
+		Number: number,
+		Name:   strings.Join(fields[3:len(fields)-2], " "),
+		Size:   size,
+	}, nil
+}
+
+// parseSize splits a text like "report.txt 12 bytes" into the name and the size
+func parseSize(text string) (string, int64, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || fields[len(fields)-1] != "bytes" {
+		return "", 0, fmt.Errorf("no size in %q", text)
+	}
+
+	size, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid size in %q", text)
+	}
+
+	return strings.Join(fields[:len(fields)-2], " "), size, nil
+}
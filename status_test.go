@@ -0,0 +1,70 @@
+package lpd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseQueueState(t *testing.T) {
+	job := newTestJob(t, "hello")
+	job.ControlFile[SourceFileName] = "hello world.txt"
+	delete(job.ControlFile, JobName)
+
+	q := &Queue{Name: "lp"}
+	q.init()
+	q.jobs = append(q.jobs, job)
+	q.active = job
+
+	for _, long := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		if err := q.writeState(buf, long, nil); err != nil {
+			t.Fatalf("error while writing state: %v", err)
+		}
+
+		state, err := ParseQueueState(buf.String(), long)
+		if err != nil {
+			t.Fatalf("error while parsing state: %v", err)
+		}
+
+		expected := QueueEntry{Rank: "active", Owner: "alice", Number: 7, Name: "hello world.txt", Size: 5}
+		if long {
+			expected.Name = ""
+			expected.Host = "host"
+			expected.Files = []QueueFile{{Name: "hello world.txt", Size: 5}}
+		}
+
+		if !reflect.DeepEqual(state.Status, []string{"lp is ready and printing"}) {
+			t.Errorf("long %v: status is not correct, got %q", long, state.Status)
+		}
+		if len(state.Jobs) != 1 || !reflect.DeepEqual(state.Jobs[0], expected) {
+			t.Errorf("long %v: jobs are not correct, expected %+v, got %+v", long, expected, state.Jobs)
+		}
+	}
+
+	// a header which fills the column is still separated from the job
+	job.ControlFile[UserID] = strings.Repeat("u", 40)
+	buf := new(bytes.Buffer)
+	if err := q.writeState(buf, true, nil); err != nil {
+		t.Fatalf("error while writing state: %v", err)
+	}
+	if state, err := ParseQueueState(buf.String(), true); err != nil || len(state.Jobs) != 1 || state.Jobs[0].Owner != job.ControlFile[UserID] {
+		t.Errorf("job with a long user name is not parsed correctly, got %+v, %v", state, err)
+	}
+
+	// the job number has three digits, a host starting with a digit follows it directly
+	state, err := ParseQueueState("\nalice: active                           [job 00710.0.0.5]\n", true)
+	if err != nil || len(state.Jobs) != 1 || state.Jobs[0].Number != 7 || state.Jobs[0].Host != "10.0.0.5" {
+		t.Errorf("job with an ip host is not parsed correctly, got %+v, %v", state, err)
+	}
+
+	state, err = ParseQueueState("lp is ready\nno entries\n", false)
+	if err != nil || len(state.Jobs) != 0 || len(state.Status) != 1 {
+		t.Errorf("empty queue is not parsed correctly, got %+v, %v", state, err)
+	}
+
+	if _, err := ParseQueueState("Rank   Owner      Job  Files                                 Total Size\n1st alice x\n", false); err == nil {
+		t.Error("invalid entry was accepted")
+	}
+}
@@ -0,0 +1,182 @@
+package lpd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port of lpd servers
+const DefaultPort = 515
+
+// DefaultHost is used for targets without a host
+const DefaultHost = "localhost"
+
+// DefaultQueue is the queue of a printer without a queue name, like the lp printer of the bsd commands
+const DefaultQueue = "lp"
+
+// targetFormats are the names of output formats accepted in the format option of a target
+var targetFormats = map[string]OutputFormat{
+	"text":       PlainTextFile,
+	"raw":        PrintWithLeavingControlCharacters,
+	"postscript": PostscriptFile,
+	"pr":         PRFormat,
+	"fortran":    FortranCarriageControlFormat,
+	"dvi":        DVIFile,
+	"troff":      TroffFormat,
+	"ditroff":    DitroffFile,
+	"cif":        CIFFile,
+	"plot":       PlotFile,
+	"raster":     RasterFormat,
+}
+
+// Target is a queue on an lpd server
+type Target struct {
+	Host  string
+	Port  int
+	Queue string
+	// Format is the output format of printed documents, defaults to PlainTextFile
+	Format OutputFormat
+	// Banner requests a banner page, defaults to true
+	Banner bool
+}
+
+// ParseTarget parses an uri like lpd://host:port/queue?format=postscript&banner=false or the short form
+// queue@host:port. IPv6 addresses are written in brackets, like queue@[::1]:515, a bare IPv6 address without
+// port is accepted in the short form too. The port defaults to DefaultPort, the host to DefaultHost.
+//
+// The format option is an output format letter like 'o' or a name like postscript, the banner option a boolean.
+func ParseTarget(target string) (*Target, error) {
+	if strings.Contains(target, "://") {
+		return parseTargetURI(target)
+	}
+
+	t := &Target{Host: DefaultHost, Port: DefaultPort, Queue: target, Format: PlainTextFile, Banner: true}
+
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		t.Queue = target[:i]
+		if err := t.setHostPort(target[i+1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Queue == "" {
+		return nil, fmt.Errorf("target %q has no queue", target)
+	}
+
+	return t, nil
+}
+
+// ParsePrinter parses a printer given to a command line tool, like $PRINTER. Unlike ParseTarget it accepts a
+// target without a queue, e.g. @host:port or an empty string, the queue is DefaultQueue then.
+func ParsePrinter(printer string) (*Target, error) {
+	if printer == "" || strings.HasPrefix(printer, "@") {
+		printer = DefaultQueue + printer
+	}
+
+	return ParseTarget(printer)
+}
+
+func parseTargetURI(target string) (*Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "lpd" {
+		return nil, fmt.Errorf("unsupported scheme %q in target %q", u.Scheme, target)
+	}
+
+	t := &Target{Host: DefaultHost, Port: DefaultPort, Queue: strings.TrimPrefix(u.Path, "/"), Format: PlainTextFile, Banner: true}
+
+	if u.Host != "" {
+		if err := t.setHostPort(u.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Queue == "" || strings.Contains(t.Queue, "/") {
+		return nil, fmt.Errorf("target %q has no valid queue", target)
+	}
+
+	query := u.Query()
+	if format := query.Get("format"); format != "" {
+		if t.Format, err = parseTargetFormat(format); err != nil {
+			return nil, err
+		}
+	}
+	if banner := query.Get("banner"); banner != "" {
+		if t.Banner, err = strconv.ParseBool(banner); err != nil {
+			return nil, fmt.Errorf("invalid banner option %q", banner)
+		}
+	}
+
+	return t, nil
+}
+
+// setHostPort sets the host and the optional port of an address like host, host:port, [::1]:port or ::1
+func (t *Target) setHostPort(addr string) error {
+	if addr == "" {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// the address has no port
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if strings.Contains(addr, ":") && net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+		t.Host = host
+		return nil
+	}
+
+	t.Host = host
+	if t.Port, err = strconv.Atoi(port); err != nil || t.Port <= 0 || t.Port > 65535 {
+		return fmt.Errorf("invalid port in address %q", addr)
+	}
+
+	return nil
+}
+
+func parseTargetFormat(format string) (OutputFormat, error) {
+	if len(format) == 1 && ControlFileCommand(format[0]).IsOutputFormat() {
+		return OutputFormat(format[0]), nil
+	}
+	if of, ok := targetFormats[format]; ok {
+		return of, nil
+	}
+
+	return 0, fmt.Errorf("unknown format %q", format)
+}
+
+// Client returns a client for the server of the target
+func (t *Target) Client() *Client {
+	return NewClient(t.Host, t.Port)
+}
+
+// PrintOptions returns the options of the target for PrintDocumentWithOptions
+func (t *Target) PrintOptions() PrintOptions {
+	return PrintOptions{NoBanner: !t.Banner}
+}
+
+// String returns the target as lpd uri
+func (t *Target) String() string {
+	u := url.URL{
+		Scheme: "lpd",
+		Host:   net.JoinHostPort(t.Host, strconv.Itoa(t.Port)),
+		Path:   "/" + t.Queue,
+	}
+
+	query := url.Values{}
+	if t.Format != 0 && t.Format != PlainTextFile {
+		query.Set("format", string([]byte{byte(t.Format)}))
+	}
+	if !t.Banner {
+		query.Set("banner", "false")
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
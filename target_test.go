@@ -0,0 +1,100 @@
+package lpd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	testCases := []struct {
+		Target   string
+		Expected Target
+	}{
+		{Target: "lp", Expected: Target{Host: "localhost", Port: 515, Queue: "lp"}},
+		{Target: "laser@printserver", Expected: Target{Host: "printserver", Port: 515, Queue: "laser"}},
+		{Target: "laser@printserver:1515", Expected: Target{Host: "printserver", Port: 1515, Queue: "laser"}},
+		{Target: "laser@[2001:db8::1]:1515", Expected: Target{Host: "2001:db8::1", Port: 1515, Queue: "laser"}},
+		{Target: "laser@2001:db8::1", Expected: Target{Host: "2001:db8::1", Port: 515, Queue: "laser"}},
+		{Target: "laser@[::1]", Expected: Target{Host: "::1", Port: 515, Queue: "laser"}},
+		{Target: "lpd://printserver/laser", Expected: Target{Host: "printserver", Port: 515, Queue: "laser"}},
+		{Target: "lpd://[::1]:1515/laser?format=postscript&banner=false", Expected: Target{Host: "::1", Port: 1515, Queue: "laser", Format: PostscriptFile}},
+		{Target: "lpd://printserver/laser?format=l&banner=true", Expected: Target{Host: "printserver", Port: 515, Queue: "laser", Format: PrintWithLeavingControlCharacters, Banner: true}},
+	}
+
+	for _, c := range testCases {
+		target, err := ParseTarget(c.Target)
+		if err != nil {
+			t.Errorf("%s: error while parsing: %v", c.Target, err)
+			continue
+		}
+
+		expected := c.Expected
+		if expected.Format == 0 {
+			expected.Format = PlainTextFile
+		}
+		if !strings.Contains(c.Target, "banner=") {
+			expected.Banner = true
+		}
+		if *target != expected {
+			t.Errorf("%s: expected %+v, got %+v", c.Target, expected, *target)
+		}
+
+		// the uri of a target is parsed to the same target
+		parsed, err := ParseTarget(target.String())
+		if err != nil || *parsed != *target {
+			t.Errorf("%s: uri %s is not parsed to the same target, got %+v, %v", c.Target, target.String(), parsed, err)
+		}
+	}
+
+	for _, invalid := range []string{
+		"", "@printserver", "laser@printserver:http", "laser@printserver:99999", "laser@printserver:1:2",
+		"ipp://printserver/laser", "lpd://printserver", "lpd://printserver/a/b", "lpd://printserver/laser?format=pdf",
+		"lpd://printserver/laser?banner=maybe",
+	} {
+		if target, err := ParseTarget(invalid); err == nil {
+			t.Errorf("invalid target %q was accepted, got %+v", invalid, target)
+		}
+	}
+}
+
+func TestParsePrinter(t *testing.T) {
+	for printer, expected := range map[string]Target{
+		"":                  {Host: "localhost", Port: 515, Queue: "lp"},
+		"@printserver:1515": {Host: "printserver", Port: 1515, Queue: "lp"},
+		"laser@printserver": {Host: "printserver", Port: 515, Queue: "laser"},
+	} {
+		expected.Format, expected.Banner = PlainTextFile, true
+
+		target, err := ParsePrinter(printer)
+		if err != nil || *target != expected {
+			t.Errorf("%q: expected %+v, got %+v, %v", printer, expected, target, err)
+		}
+	}
+}
+
+func TestTargetClient(t *testing.T) {
+	backend := newRecordingBackend()
+	_, client := startTestServer(t, &Queue{Name: "lp", Backend: backend})
+
+	target, err := ParseTarget("lpd://" + client.dest + "/lp?format=o&banner=false")
+	if err != nil {
+		t.Fatalf("error while parsing target: %v", err)
+	}
+
+	err = target.Client().PrintDocumentWithOptions(Document{
+		Document: strings.NewReader("%!PS"),
+		Size:     4,
+		Name:     "doc.ps",
+	}, target.Queue, nil, target.Format, target.PrintOptions())
+	if err != nil {
+		t.Fatalf("error while printing document: %v", err)
+	}
+
+	received := backend.next(t)
+	if lines := received.Job.PrintLines(); len(lines) != 1 || lines[0].Format != PostscriptFile {
+		t.Errorf("print lines are not correct, got %v", lines)
+	}
+	if _, ok := received.Job.ControlFile[PrintBanner]; ok {
+		t.Error("banner was requested")
+	}
+}
@@ -0,0 +1,180 @@
+package lpd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultTransferGrace is the head start of a client before MinTransferRate is enforced, if Transfer is not set
+const DefaultTransferGrace = 5 * time.Second
+
+var (
+	errTooManyConns      = errors.New("too many connections")
+	errTooManyConnsPerIP = errors.New("too many connections from the same address")
+)
+
+// Timeouts protect the server against idle and slow clients. Zero values disable a timeout.
+type Timeouts struct {
+	// Idle is the time the server waits for the first byte of the next command line
+	Idle time.Duration
+	// Header is the time a client has to complete a command line once it started it
+	Header time.Duration
+	// Transfer is the time a client may stall while it sends a file, it is also the head start before
+	// MinTransferRate is enforced
+	Transfer time.Duration
+	// MinTransferRate is the minimal average rate in bytes per second at which a file has to be sent
+	MinTransferRate int64
+	// Write is the time the server waits until a response is written
+	Write time.Duration
+}
+
+// transferDeadline returns the read deadline for a file transfer which started at start and read n bytes so far
+func (t Timeouts) transferDeadline(start time.Time, n int64) time.Time {
+	var deadline time.Time
+
+	if t.MinTransferRate > 0 {
+		grace := t.Transfer
+		if grace <= 0 {
+			grace = DefaultTransferGrace
+		}
+		expected := time.Duration(float64(n) / float64(t.MinTransferRate) * float64(time.Second))
+		deadline = start.Add(grace + expected)
+	}
+
+	if t.Transfer > 0 {
+		stall := time.Now().Add(t.Transfer)
+		if deadline.IsZero() || stall.Before(deadline) {
+			deadline = stall
+		}
+	}
+
+	return deadline
+}
+
+// ConnStats are counters of the connections handled by the server
+type ConnStats struct {
+	Accepted uint64
+	Active   int
+	// DroppedMaxConns counts connections which were closed because of the MaxConns limit
+	DroppedMaxConns uint64
+	// DroppedPerIP counts connections which were closed because of the MaxConnsPerIP limit
+	DroppedPerIP uint64
+	// DroppedTimeout counts connections which were closed because a timeout expired
+	DroppedTimeout uint64
+}
+
+// ConnStats returns the connection counters of the server
+func (s *Server) ConnStats() ConnStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Active = len(s.conns)
+
+	return stats
+}
+
+// serverConn is an accepted connection, it applies the write timeout and notes expired read deadlines
+type serverConn struct {
+	net.Conn
+	host     string
+	timeouts Timeouts
+	timedOut bool
+}
+
+func newServerConn(conn net.Conn, timeouts Timeouts) *serverConn {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+
+	return &serverConn{Conn: conn, host: host, timeouts: timeouts}
+}
+
+func (c *serverConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		c.timedOut = true
+	}
+
+	return n, err
+}
+
+func (c *serverConn) Write(p []byte) (int, error) {
+	if c.timeouts.Write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeouts.Write))
+	}
+
+	n, err := c.Conn.Write(p)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		c.timedOut = true
+	}
+
+	return n, err
+}
+
+// readDaemonCommand reads the first command line of a client within the idle and header timeouts
+func (c *serverConn) readDaemonCommand(r *bufio.Reader) (*DaemonCommandLine, error) {
+	if err := c.awaitCommand(r); err != nil {
+		return nil, err
+	}
+
+	return ReadDaemonCommand(r)
+}
+
+// readSubCommand reads the next sub command line of a client within the idle and header timeouts
+func (c *serverConn) readSubCommand(r *bufio.Reader) (*SubCommandLine, error) {
+	if err := c.awaitCommand(r); err != nil {
+		return nil, err
+	}
+
+	return ReadSubCommand(r)
+}
+
+// awaitCommand waits for the next command line within the idle timeout, the line has to follow within the header
+// timeout
+func (c *serverConn) awaitCommand(r *bufio.Reader) error {
+	if r.Buffered() == 0 {
+		c.setReadTimeout(c.timeouts.Idle)
+		if _, err := r.Peek(1); err != nil {
+			return err
+		}
+	}
+
+	c.setReadTimeout(c.timeouts.Header)
+
+	return nil
+}
+
+func (c *serverConn) setReadTimeout(d time.Duration) {
+	var deadline time.Time
+	if d > 0 {
+		deadline = time.Now().Add(d)
+	}
+
+	c.SetReadDeadline(deadline)
+}
+
+// transferReader returns a reader for a file sent by the client, which enforces the transfer timeouts
+func (c *serverConn) transferReader(r io.Reader) io.Reader {
+	return &transferReader{r: r, conn: c, start: time.Now()}
+}
+
+type transferReader struct {
+	r     io.Reader
+	conn  *serverConn
+	start time.Time
+	read  int64
+}
+
+func (t *transferReader) Read(p []byte) (int, error) {
+	t.conn.SetReadDeadline(t.conn.timeouts.transferDeadline(t.start, t.read))
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,134 @@
+package lpd
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitConnStats polls the connection counters until check succeeds
+func waitConnStats(t *testing.T, s *Server, check func(ConnStats) bool) ConnStats {
+	t.Helper()
+
+	var stats ConnStats
+	for i := 0; i < 200; i++ {
+		if stats = s.ConnStats(); check(stats) {
+			return stats
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("connection counters did not change, got %+v", stats)
+	return stats
+}
+
+// expectClosed checks that the server closes the connection
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Errorf("connection was not closed by the server: %v", err)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	s, client := startConfiguredTestServer(t, func(s *Server) {
+		s.Timeouts = Timeouts{Idle: 50 * time.Millisecond}
+	}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn := startRawReceiveJob(t, client)
+	expectClosed(t, conn)
+
+	waitConnStats(t, s, func(stats ConnStats) bool { return stats.DroppedTimeout == 1 })
+}
+
+func TestServerHeaderTimeout(t *testing.T) {
+	s, client := startConfiguredTestServer(t, func(s *Server) {
+		s.Timeouts = Timeouts{Header: 50 * time.Millisecond}
+	}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn, err := net.Dial("tcp", client.dest)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close()
+
+	// the command line is never finished
+	conn.Write([]byte{byte(ReceiveJob), 'l'})
+	expectClosed(t, conn)
+
+	waitConnStats(t, s, func(stats ConnStats) bool { return stats.DroppedTimeout == 1 })
+}
+
+func TestServerTransferRate(t *testing.T) {
+	s, client := startConfiguredTestServer(t, func(s *Server) {
+		s.Timeouts = Timeouts{Transfer: 50 * time.Millisecond, MinTransferRate: 1000}
+	}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	conn := startRawReceiveJob(t, client)
+	if err := SendCommandLine(conn, byte(SendDataFile), []string{"1000", "dfA001host"}); err != nil {
+		t.Fatalf("error while sending command: %v", err)
+	}
+	if err := CheckAcknowledge(conn); err != nil {
+		t.Fatalf("data file command was not acknowledged: %v", err)
+	}
+
+	// one byte every 20ms is slower than the minimal rate, although the client never stalls
+	for i := 0; i < 20; i++ {
+		if _, err := conn.Write([]byte("x")); err != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	expectClosed(t, conn)
+
+	waitConnStats(t, s, func(stats ConnStats) bool { return stats.DroppedTimeout == 1 })
+}
+
+func TestServerConnLimits(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Limits  Limits
+		Dropped func(ConnStats) uint64
+	}{
+		{Name: "max conns", Limits: Limits{MaxConns: 1}, Dropped: func(stats ConnStats) uint64 { return stats.DroppedMaxConns }},
+		{Name: "per ip", Limits: Limits{MaxConnsPerIP: 1}, Dropped: func(stats ConnStats) uint64 { return stats.DroppedPerIP }},
+	}
+
+	for _, c := range testCases {
+		s, client := startConfiguredTestServer(t, func(s *Server) {
+			s.Limits = c.Limits
+		}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+		startRawReceiveJob(t, client)
+
+		conn, err := net.Dial("tcp", client.dest)
+		if err != nil {
+			t.Fatalf("%s: could not connect: %v", c.Name, err)
+		}
+		expectClosed(t, conn)
+		conn.Close()
+
+		stats := waitConnStats(t, s, func(stats ConnStats) bool { return c.Dropped(stats) == 1 })
+		if stats.Accepted != 1 || stats.Active != 1 {
+			t.Errorf("%s: connection counters are not correct, got %+v", c.Name, stats)
+		}
+	}
+
+	// jobs are received normally within the limits
+	_, client := startConfiguredTestServer(t, func(s *Server) {
+		s.Limits = Limits{MaxConns: 1, MaxConnsPerIP: 1}
+	}, &Queue{Name: "lp", Backend: newRecordingBackend()})
+
+	err := client.PrintDocument(Document{
+		Document: strings.NewReader("data"),
+		Size:     4,
+		Name:     "data.txt",
+	}, "lp", nil, PlainTextFile)
+	if err != nil {
+		t.Errorf("job within the connection limits was rejected: %v", err)
+	}
+}